@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// secretFlags are not printed when --verbose lists where settings came from.
+var secretFlags = map[string]bool{"redis-password": true, "redis-url": true, "login-form": true, "post-body": true}
+
+// applyConfigFile sets flags from a YAML (.yaml, .yml) or JSON file whose keys
+// are flag names, e.g. {"depth": 2, "same-domain": true, "header": ["A: b"]}.
+// Flags already given on the command line win over the file. Every value goes
+// through the flag's own parser, so the file is validated exactly like the
+// command line. It returns the names of the flags the file set.
+func applyConfigFile(path string, fs *flag.FlagSet) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var settings map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &settings)
+	case ".json":
+		err = json.Unmarshal(data, &settings)
+	default:
+		return nil, fmt.Errorf("%s: config file must be .yaml, .yml or .json", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	onCommandLine := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { onCommandLine[f.Name] = true })
+
+	var applied []string
+	for name, value := range settings {
+		f := fs.Lookup(name)
+		if f == nil || name == "config" {
+			return nil, fmt.Errorf("%s: unknown setting %q", path, name)
+		}
+		if onCommandLine[name] {
+			continue
+		}
+		values, err := configValues(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", path, name, err)
+		}
+		// Repeatable flags take one value per entry; the rest take a
+		// comma-separated list
+		if _, repeatable := f.Value.(*stringList); !repeatable {
+			values = []string{strings.Join(values, ",")}
+		}
+		for _, v := range values {
+			if err := fs.Set(name, v); err != nil {
+				return nil, fmt.Errorf("%s: invalid value %q for %s: %w", path, v, name, err)
+			}
+		}
+		applied = append(applied, name)
+	}
+	return applied, nil
+}
+
+// configValues converts a decoded YAML or JSON value to flag strings. Lists
+// give one string per element.
+func configValues(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case []interface{}:
+		var values []string
+		for _, elem := range v {
+			s, err := configValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, s)
+		}
+		return values, nil
+	default:
+		s, err := configValue(v)
+		if err != nil {
+			return nil, err
+		}
+		return []string{s}, nil
+	}
+}
+
+func configValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case nil:
+		return "", nil
+	}
+	return "", fmt.Errorf("unsupported value %v", value)
+}
+
+// logSettingSources logs every flag that is set, and whether its value came
+// from the command line or the config file, for --verbose.
+func logSettingSources(fs *flag.FlagSet, fromFile []string) {
+	file := make(map[string]bool, len(fromFile))
+	for _, name := range fromFile {
+		file[name] = true
+	}
+	fs.Visit(func(f *flag.Flag) {
+		value := f.Value.String()
+		if secretFlags[f.Name] {
+			value = "(redacted)"
+		}
+		source := "flag"
+		if file[f.Name] {
+			source = "file"
+		}
+		slog.Info("Setting", "name", f.Name, "value", value, "source", source)
+	})
+}
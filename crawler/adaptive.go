@@ -0,0 +1,122 @@
+package crawler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// adaptiveWindow is how many fetch outcomes are collected before an adaptive
+// limit is adjusted.
+const adaptiveWindow = 20
+
+// slowdownFactor is how much the window's mean latency may exceed the fastest
+// window seen before the limit is treated as too high.
+const slowdownFactor = 2
+
+// requestLimiter caps how many page fetches are in progress at once. A fixed
+// limiter keeps its limit; an adaptive one adjusts it AIMD-style between min
+// and max from each window of outcomes: +1 when every response in the window
+// was fast and non-throttled, halved on any 429, 5xx or network error, or when
+// latency rises well above the best seen.
+type requestLimiter struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	limit int
+	inUse int
+
+	adaptive bool
+	min, max int
+
+	// Outcomes of the current window
+	count     int
+	failures  int
+	latencies time.Duration
+	// fastest is the lowest window mean latency seen so far
+	fastest time.Duration
+}
+
+func newRequestLimiter(limit int) *requestLimiter {
+	l := &requestLimiter{limit: limit}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// newAdaptiveLimiter starts at min concurrent fetches and grows towards max.
+func newAdaptiveLimiter(min, max int) *requestLimiter {
+	l := newRequestLimiter(min)
+	l.adaptive, l.min, l.max = true, min, max
+	return l
+}
+
+// acquire blocks until a fetch may start.
+func (l *requestLimiter) acquire() {
+	l.mu.Lock()
+	for l.inUse >= l.limit {
+		l.cond.Wait()
+	}
+	l.inUse++
+	l.mu.Unlock()
+}
+
+// release ends a fetch started with acquire, feeding its outcome to an
+// adaptive limit.
+func (l *requestLimiter) release(page *Page, err error, latency time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inUse--
+	if l.adaptive {
+		l.observe(throttled(page, err), latency)
+	}
+	l.cond.Broadcast()
+}
+
+// Limit returns the current number of fetches allowed at once.
+func (l *requestLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// observe records one outcome and adjusts the limit at the end of a window.
+// l.mu must be held.
+func (l *requestLimiter) observe(failed bool, latency time.Duration) {
+	l.count++
+	l.latencies += latency
+	if failed {
+		l.failures++
+	}
+	if l.count < adaptiveWindow {
+		return
+	}
+
+	mean := l.latencies / time.Duration(l.count)
+	if l.fastest == 0 || mean < l.fastest {
+		l.fastest = mean
+	}
+	previous := l.limit
+	switch {
+	case l.failures > 0 || mean > l.fastest*slowdownFactor:
+		l.limit = max(l.min, l.limit/2)
+	case l.limit < l.max:
+		l.limit++
+	}
+	if l.limit != previous {
+		slog.Debug("Adjusted concurrency", "limit", l.limit, "previous", previous, "mean_latency", mean, "failures", l.failures)
+	}
+	l.count, l.failures, l.latencies = 0, 0, 0
+}
+
+// throttled reports whether a fetch outcome suggests the crawl is pushing the
+// site too hard: a 429, a 5xx, or no response at all.
+func throttled(page *Page, err error) bool {
+	if err == nil || errors.Is(err, ErrSkip) {
+		return false
+	}
+	if page == nil || page.Status == 0 {
+		return true
+	}
+	return page.Status == http.StatusTooManyRequests || page.Status >= 500
+}
@@ -0,0 +1,68 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Queue is the crawl frontier every worker pops jobs from.
+type Queue interface {
+	// Push adds item with the given priority score; lower scores are popped
+	// first, and equal scores in push order so a single-worker crawl visits
+	// pages in the same order every run. It returns false if an identical
+	// job is already queued.
+	Push(ctx context.Context, item WorkItem, score float64) (bool, error)
+	// Defer adds item to be pushed with score once until has passed, so it
+	// isn't popped before then.
+	Defer(ctx context.Context, item WorkItem, score float64, until time.Time) error
+	// Pop waits up to timeout for the lowest-scored job, returning
+	// ErrQueueEmpty if none arrived. Deferred jobs that are due are pushed
+	// first.
+	Pop(ctx context.Context, timeout time.Duration) (WorkItem, error)
+	// QueueLen returns how many jobs are waiting, deferred ones included.
+	QueueLen(ctx context.Context) (int64, error)
+}
+
+// VisitedSet records which URLs have been claimed for crawling, so each is
+// queued once.
+type VisitedSet interface {
+	// CheckAndMark atomically marks u visited and reports whether it already
+	// was.
+	CheckAndMark(ctx context.Context, u string) (bool, error)
+	// Unmark forgets u so it can be queued again.
+	Unmark(ctx context.Context, u string) error
+	// VisitedCount returns how many URLs are marked.
+	VisitedCount(ctx context.Context) (int64, error)
+}
+
+// jobCounters are the per-job tallies the crawler keeps next to its queue:
+// page budgets, status and depth counts, and jobs in flight. RedisClient and
+// memoryBackend implement them.
+type jobCounters interface {
+	ClaimPage(ctx context.Context, max int) (bool, error)
+	PagesClaimed(ctx context.Context) (int64, error)
+	ClaimHostPage(ctx context.Context, host string, max int) (bool, error)
+	HostPageCounts(ctx context.Context) (map[string]int64, error)
+	CountStatus(ctx context.Context, status string) error
+	StatusCounts(ctx context.Context) (map[string]int64, error)
+	recordDepth(ctx context.Context, u string, depth int) error
+	DepthCounts(ctx context.Context) (map[int]int64, error)
+	recordSoft404(ctx context.Context, u string) error
+	Soft404s(ctx context.Context) ([]string, error)
+	recordTLSError(ctx context.Context, u string) error
+	TLSErrors(ctx context.Context) ([]string, error)
+	recordOverflow(ctx context.Context, u string) error
+	OverflowCount(ctx context.Context) (int64, error)
+	StartJob(ctx context.Context) error
+	FinishJob(ctx context.Context) error
+	InFlight(ctx context.Context) (int64, error)
+}
+
+// ErrQueueEmpty is returned by Queue.Pop when no job arrived in time.
+var ErrQueueEmpty = errors.New("queue empty")
+
+// ErrMalformedJob is returned by Queue.Pop for a job it took off the queue
+// but couldn't use, such as one pushed by an external tool without a URL.
+// The job is gone; the worker drops it and pops the next.
+var ErrMalformedJob = errors.New("malformed job")
@@ -0,0 +1,70 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// bloomFilter configures the RedisBloom filter that replaces the visited:<id>
+// set with --dedup=bloom. A filter can't forget an item, so URLs that are
+// un-marked are kept in the unvisited:<id> set until they are marked again.
+type bloomFilter struct {
+	capacity  int64
+	errorRate float64
+}
+
+// reserveBloom creates the job's visited_bloom:<id> filter with the configured
+// capacity and error rate unless it already exists. Without it BF.ADD would
+// create a small default filter on first use. The filter expands once
+// capacity is passed, at some cost in memory and false positives.
+func (r *RedisClient) reserveBloom(ctx context.Context) error {
+	if r.bloom == nil {
+		return nil
+	}
+	key := r.key("visited_bloom")
+	exists, err := r.client.Exists(ctx, key).Result()
+	if err != nil || exists == 1 {
+		return err
+	}
+	err = r.client.Do(ctx, "BF.RESERVE", key, r.bloom.errorRate, r.bloom.capacity).Err()
+	// Another process may have reserved it first
+	if err != nil && !strings.Contains(err.Error(), "exists") {
+		return fmt.Errorf("creating bloom filter %s (is the RedisBloom module loaded?): %w", key, err)
+	}
+	return nil
+}
+
+// bloomCheckAndMark reports whether u was already in the filter, adding it if
+// not. A URL that was un-marked is taken out of unvisited:<id> instead, and
+// whichever caller removes it treats it as new.
+func (r *RedisClient) bloomCheckAndMark(ctx context.Context, u string) (bool, error) {
+	removed, err := r.client.SRem(ctx, r.key("unvisited"), u).Result()
+	if err != nil {
+		return false, err
+	}
+	if removed == 1 {
+		return false, nil
+	}
+	added, err := r.client.Do(ctx, "BF.ADD", r.key("visited_bloom"), u).Int64()
+	return added == 0, err
+}
+
+// bloomUnmark lets u be marked again.
+func (r *RedisClient) bloomUnmark(ctx context.Context, u string) error {
+	return r.client.SAdd(ctx, r.key("unvisited"), u).Err()
+}
+
+// bloomVisitedCount estimates how many URLs are marked: the number added to
+// the filter, less those un-marked since.
+func (r *RedisClient) bloomVisitedCount(ctx context.Context) (int64, error) {
+	added, err := r.client.Do(ctx, "BF.CARD", r.key("visited_bloom")).Int64()
+	if err != nil {
+		return 0, err
+	}
+	unmarked, err := r.client.SCard(ctx, r.key("unvisited")).Result()
+	if err != nil {
+		return 0, err
+	}
+	return added - unmarked, nil
+}
@@ -0,0 +1,239 @@
+package crawler
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// DefaultBreakerCooldown is how long an open circuit stops a host from being
+// fetched when BreakerCooldown is 0.
+const DefaultBreakerCooldown = time.Minute
+
+// checkCircuit decides whether a host whose circuit breaker is the hash
+// KEYS[1] may be fetched at ARGV[1] milliseconds. It returns 0 if the circuit
+// is closed and -1 if the cooldown is over and the caller takes the one probe
+// of the half-open circuit, which is leased for ARGV[2] milliseconds.
+// Otherwise it returns how many milliseconds to wait before asking again.
+var checkCircuit = redis.NewScript(`
+local open_until = tonumber(redis.call("HGET", KEYS[1], "open_until") or "0")
+if open_until == 0 then
+	return 0
+end
+local now = tonumber(ARGV[1])
+if now < open_until then
+	return open_until - now
+end
+local probe_until = tonumber(redis.call("HGET", KEYS[1], "probe_until") or "0")
+if now < probe_until then
+	return probe_until - now
+end
+redis.call("HSET", KEYS[1], "probe_until", now + tonumber(ARGV[2]))
+return -1
+`)
+
+// recordFetch records the outcome of a fetch at ARGV[2] milliseconds in the
+// circuit breaker hash KEYS[1]: ARGV[1] is 1 for a success, which closes the
+// circuit, or 0 for a failure. The failure that makes ARGV[3] in a row, or
+// fails the half-open probe, opens the circuit for ARGV[4] milliseconds and
+// returns 1; failures of fetches that started before it opened return 0
+// without extending the cooldown.
+var recordFetch = redis.NewScript(`
+if ARGV[1] == "1" then
+	redis.call("DEL", KEYS[1])
+	return 0
+end
+local now = tonumber(ARGV[2])
+local failures = redis.call("HINCRBY", KEYS[1], "failures", 1)
+local open_until = tonumber(redis.call("HGET", KEYS[1], "open_until") or "0")
+if now < open_until or (open_until == 0 and failures < tonumber(ARGV[3])) then
+	return 0
+end
+redis.call("HSET", KEYS[1], "open_until", now + tonumber(ARGV[4]), "probe_until", 0)
+return 1
+`)
+
+// hostBreakers is a circuit breaker per host: after threshold consecutive
+// failed fetches from a host, its circuit opens and its jobs are deferred, or
+// dropped, for cooldown. Then it is half-open: one probe fetch is let through,
+// which closes the circuit if it succeeds and reopens it if it fails. State
+// is kept in the breaker:<id>:<host> Redis hashes so every worker and every
+// crawler process shares it; with a nil redisClient (the memory backend) it
+// is only kept in process. A nil hostBreakers (BreakerThreshold 0) lets every
+// fetch through.
+type hostBreakers struct {
+	redisClient *RedisClient
+	threshold   int
+	cooldown    time.Duration
+	// probeLease is how long the probe of a half-open circuit has before
+	// another job may probe instead
+	probeLease time.Duration
+	drop       bool
+
+	mu    sync.Mutex
+	local map[string]*circuit
+}
+
+// circuit is one host's breaker state when kept in process.
+type circuit struct {
+	failures   int
+	openUntil  time.Time
+	probeUntil time.Time
+}
+
+func newHostBreakers(redisClient *RedisClient, threshold int, cooldown, probeLease time.Duration, drop bool) *hostBreakers {
+	return &hostBreakers{
+		redisClient: redisClient,
+		threshold:   threshold,
+		cooldown:    cooldown,
+		probeLease:  probeLease,
+		drop:        drop,
+		local:       make(map[string]*circuit),
+	}
+}
+
+// check reports whether host may be fetched now. If not, wait is how long
+// until its circuit may let a fetch through. probe is set when the caller is
+// the one fetch a half-open circuit lets through.
+func (b *hostBreakers) check(ctx context.Context, host string) (wait time.Duration, probe bool) {
+	if b == nil {
+		return 0, false
+	}
+	now := time.Now()
+	if b.redisClient == nil {
+		return b.checkLocal(host, now)
+	}
+	ms, err := checkCircuit.Run(ctx, b.redisClient.client, []string{b.redisClient.urlKey("breaker", host)}, now.UnixMilli(), b.probeLease.Milliseconds()).Int64()
+	if err != nil {
+		// Fetch it; the breaker only saves requests to a host that's failing
+		slog.Warn("Redis error checking circuit breaker", "host", host, "error", err)
+		return 0, false
+	}
+	if ms < 0 {
+		return 0, true
+	}
+	return time.Duration(ms) * time.Millisecond, false
+}
+
+func (b *hostBreakers) checkLocal(host string, now time.Time) (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.local[host]
+	switch {
+	case c == nil || c.openUntil.IsZero():
+		return 0, false
+	case now.Before(c.openUntil):
+		return c.openUntil.Sub(now), false
+	case now.Before(c.probeUntil):
+		return c.probeUntil.Sub(now), false
+	}
+	c.probeUntil = now.Add(b.probeLease)
+	return 0, true
+}
+
+// record counts a fetch from host against its circuit, returning true if
+// this failure opened it.
+func (b *hostBreakers) record(ctx context.Context, host string, failed bool) bool {
+	if b == nil {
+		return false
+	}
+	now := time.Now()
+	if b.redisClient == nil {
+		return b.recordLocal(host, failed, now)
+	}
+	ok := 1
+	if failed {
+		ok = 0
+	}
+	opened, err := recordFetch.Run(ctx, b.redisClient.client, []string{b.redisClient.urlKey("breaker", host)}, ok, now.UnixMilli(), b.threshold, b.cooldown.Milliseconds()).Int()
+	if err != nil {
+		slog.Warn("Redis error recording fetch for circuit breaker", "host", host, "error", err)
+		return false
+	}
+	return opened == 1
+}
+
+func (b *hostBreakers) recordLocal(host string, failed bool, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !failed {
+		delete(b.local, host)
+		return false
+	}
+	c := b.local[host]
+	if c == nil {
+		c = &circuit{}
+		b.local[host] = c
+	}
+	c.failures++
+	if now.Before(c.openUntil) || (c.openUntil.IsZero() && c.failures < b.threshold) {
+		return false
+	}
+	c.openUntil = now.Add(b.cooldown)
+	c.probeUntil = time.Time{}
+	return true
+}
+
+// hostFailure reports whether a fetch failed in a way that says the host,
+// rather than the page, is in trouble: no response at all, a 5xx, or a 429.
+func hostFailure(page *Page, err error) bool {
+	if err == nil {
+		return false
+	}
+	return page == nil || page.Status >= 500 || page.Status == http.StatusTooManyRequests
+}
+
+// circuitOpen checks item's host against its circuit breaker before a fetch,
+// returning true if the job isn't fetched now. While the circuit is open the
+// job is deferred until the circuit may let a fetch through, and the worker
+// moves on to the next job; a job deferred maxCircuitDefers times is moved to
+// the dead-letter list. With BreakerMode "drop" the job is dropped straight
+// away instead, and left unvisited.
+func (c *Crawler) circuitOpen(ctx context.Context, logger *slog.Logger, item WorkItem) bool {
+	host := hostOf(item.URL)
+	wait, probe := c.breakers.check(ctx, host)
+	if probe {
+		logger.Info("Probing host after circuit cooldown", "host", host)
+	}
+	if wait <= 0 {
+		return false
+	}
+	if item.Deferrals == 0 {
+		circuitOpenJobs.Inc()
+	}
+	// The job is already off the queue, so putting it back outlives shutdown
+	ctx = context.WithoutCancel(ctx)
+	switch {
+	case c.breakers.drop:
+		logger.Info("Host circuit open, dropping job", "host", host, "retry_in", wait.Round(time.Millisecond))
+	case item.Deferrals >= maxCircuitDefers:
+		logger.Warn("Giving up on URL, host circuit still open", "host", host, "deferrals", item.Deferrals)
+		c.deadLetter(ctx, logger, item, "circuit open")
+		return true
+	default:
+		item.Deferrals++
+		err := c.queue.Defer(ctx, item, c.priority(item.Depth), time.Now().Add(wait))
+		if err == nil {
+			logger.Debug("Host circuit open, deferred", "host", host, "retry_in", wait.Round(time.Millisecond))
+			return true
+		}
+		logger.Error("Redis error deferring job, dropping it", "error", err)
+	}
+	if err := c.visited.Unmark(ctx, item.URL); err != nil {
+		logger.Warn("Redis error un-marking URL", "error", err)
+	}
+	return true
+}
+
+// recordHostOutcome counts a fetch against its host's circuit breaker.
+func (c *Crawler) recordHostOutcome(ctx context.Context, logger *slog.Logger, item WorkItem, page *Page, err error) {
+	host := hostOf(item.URL)
+	if c.breakers.record(ctx, host, hostFailure(page, err)) {
+		circuitOpened.Inc()
+		logger.Warn("Host failing, circuit opened", "host", host, "threshold", c.breakers.threshold, "cooldown", c.breakers.cooldown, "error", err)
+	}
+}
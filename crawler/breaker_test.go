@@ -0,0 +1,147 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// breakerCrawler is a Crawler on backend whose circuits open after one
+// failure and stay open for cooldown.
+func breakerCrawler(t *testing.T, backend string, cooldown time.Duration) *Crawler {
+	t.Helper()
+	cfg := memoryConfig("http://example.com/")
+	cfg.BreakerThreshold = 1
+	cfg.BreakerCooldown = cooldown
+	if backend == "redis" {
+		cfg.Backend = "redis"
+		cfg.RedisAddr = miniredis.RunT(t).Addr()
+	}
+	c, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// A job for an open circuit is set aside until the cooldown is over, rather
+// than holding up its worker, and still counts as queued meanwhile.
+func TestCircuitOpenDefersJob(t *testing.T) {
+	const cooldown = 300 * time.Millisecond
+	for _, backend := range []string{"memory", "redis"} {
+		t.Run(backend, func(t *testing.T) {
+			c := breakerCrawler(t, backend, cooldown)
+			ctx := context.Background()
+			item := WorkItem{URL: "http://example.com/a", TraceID: "trace"}
+			c.breakers.record(ctx, "example.com", true)
+
+			start := time.Now()
+			if !c.circuitOpen(ctx, slog.Default(), item) {
+				t.Fatal("circuitOpen = false with the circuit open")
+			}
+			if elapsed := time.Since(start); elapsed >= cooldown {
+				t.Errorf("circuitOpen took %v, want it not to wait out the cooldown", elapsed)
+			}
+			if n, err := c.queue.QueueLen(ctx); err != nil || n != 1 {
+				t.Errorf("QueueLen = %d, %v; want 1, nil", n, err)
+			}
+			if _, err := c.queue.Pop(ctx, 50*time.Millisecond); err != ErrQueueEmpty {
+				t.Errorf("Pop before the job was due = %v, want ErrQueueEmpty", err)
+			}
+
+			var got WorkItem
+			var err error
+			for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+				if got, err = c.queue.Pop(ctx, 100*time.Millisecond); err != ErrQueueEmpty {
+					break
+				}
+			}
+			if err != nil {
+				t.Fatalf("Pop after the job was due: %v", err)
+			}
+			if since := time.Since(start); since < cooldown-50*time.Millisecond {
+				t.Errorf("deferred job popped after %v, want about %v", since, cooldown)
+			}
+			item.Deferrals = 1
+			if got != item {
+				t.Errorf("popped %+v, want %+v", got, item)
+			}
+
+			// The cooldown is over, so the job probes the half-open circuit
+			if c.circuitOpen(ctx, slog.Default(), got) {
+				t.Error("circuitOpen = true after the cooldown, want the probe let through")
+			}
+		})
+	}
+}
+
+// A job deferred maxCircuitDefers times is given up on and, with Redis,
+// moved to the dead-letter list.
+func TestCircuitOpenGivesUp(t *testing.T) {
+	for _, backend := range []string{"memory", "redis"} {
+		t.Run(backend, func(t *testing.T) {
+			c := breakerCrawler(t, backend, time.Minute)
+			ctx := context.Background()
+			item := WorkItem{URL: "http://example.com/a", Deferrals: maxCircuitDefers}
+			c.visited.CheckAndMark(ctx, item.URL)
+			c.breakers.record(ctx, "example.com", true)
+
+			if !c.circuitOpen(ctx, slog.Default(), item) {
+				t.Fatal("circuitOpen = false with the circuit open")
+			}
+			if n, _ := c.queue.QueueLen(ctx); n != 0 {
+				t.Errorf("QueueLen = %d after giving up, want 0", n)
+			}
+			if c.redisClient == nil {
+				return
+			}
+			dead, err := c.redisClient.client.LRange(ctx, c.redisClient.key("jobs_dead"), 0, -1).Result()
+			if err != nil {
+				t.Fatalf("LRANGE jobs_dead: %v", err)
+			}
+			var job Job
+			if len(dead) != 1 || json.Unmarshal([]byte(dead[0]), &job) != nil || job.URL != item.URL || job.Error != "circuit open" {
+				t.Errorf("jobs_dead = %v, want %s with the reason \"circuit open\"", dead, item.URL)
+			}
+		})
+	}
+}
+
+// A crawl whose only queued job is deferred waits for it rather than ending.
+func TestCrawlWaitsForDeferredJobs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, links("/broken", "/b"))
+		case "/b":
+			fmt.Fprint(w, links())
+		default:
+			http.Error(w, "unavailable", http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	cfg := memoryConfig(server.URL + "/")
+	cfg.Workers = 1
+	cfg.BreakerThreshold = 1
+	cfg.BreakerCooldown = 200 * time.Millisecond
+	var got []string
+	for _, result := range crawl(t, cfg) {
+		if result.Error == "" {
+			got = append(got, result.URL)
+		}
+	}
+	want := []string{server.URL + "/", server.URL + "/b"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("fetched %q, want %q", got, want)
+	}
+}
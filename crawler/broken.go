@@ -0,0 +1,103 @@
+package crawler
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"os"
+	"sort"
+	"strings"
+)
+
+// recordBroken stores a failed fetch's status in the job's broken hash, and
+// the job's attempt, if it had been re-queued, in broken_attempts.
+func (r *RedisClient) recordBroken(ctx context.Context, u, status string, attempt int) error {
+	if err := r.client.HSet(ctx, r.key("broken"), u, status).Err(); err != nil {
+		return err
+	}
+	if attempt == 0 {
+		return nil
+	}
+	return r.client.HSet(ctx, r.key("broken_attempts"), u, attempt).Err()
+}
+
+// broken reports whether a fetch outcome belongs in the broken-link report:
+// a 4xx or 5xx response, or no response at all.
+func broken(page *Page) bool {
+	return page == nil || page.Status == 0 || page.Status >= 400
+}
+
+// exportBroken writes a "broken_url,status,referrer,attempt" CSV to path with one row
+// per page linking to each broken URL, found by inverting the recorded link
+// edges. Broken URLs no page links to, such as seeds, get one row with an
+// empty referrer. It returns how many broken URLs were written.
+func exportBroken(ctx context.Context, r *RedisClient, path string) (int, error) {
+	statuses, err := r.client.HGetAll(ctx, r.key("broken")).Result()
+	if err != nil {
+		return 0, err
+	}
+	attempts, err := r.client.HGetAll(ctx, r.key("broken_attempts")).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	referrers := make(map[string][]string, len(statuses))
+	prefix := r.urlKey("links", "")
+	err = r.scan(ctx, prefix+"*", func(key string) error {
+		targets, err := r.client.SMembers(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		from := strings.TrimPrefix(key, prefix)
+		for _, to := range targets {
+			if _, ok := statuses[to]; ok {
+				referrers[to] = append(referrers[to], from)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	urls := make([]string, 0, len(statuses))
+	for u := range statuses {
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"broken_url", "status", "referrer", "attempt"}); err != nil {
+		return 0, err
+	}
+	for _, u := range urls {
+		from := referrers[u]
+		if len(from) == 0 {
+			from = []string{""}
+		}
+		sort.Strings(from)
+		attempt := attempts[u]
+		if attempt == "" {
+			attempt = "0"
+		}
+		for _, ref := range from {
+			if err := cw.Write([]string{u, statuses[u], ref, attempt}); err != nil {
+				return 0, err
+			}
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return 0, err
+	}
+	if err := w.Flush(); err != nil {
+		return 0, err
+	}
+	return len(urls), f.Close()
+}
@@ -0,0 +1,119 @@
+package crawler
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Change classifications for --detect-changes, as written to PageResult.Change.
+const (
+	changeNew       = "new"
+	changeChanged   = "changed"
+	changeUnchanged = "unchanged"
+	changeRemoved   = "removed"
+)
+
+// The content hash of every page crawled by a job is kept in the
+// page_hashes:<id> hash, from URL to contentHash, which --reset leaves alone
+// so the next run can be compared against it. The URLs hashed by the current
+// run are collected in hashes_seen:<id>, and change_counts:<id> tallies the
+// run's classifications; --reset clears both. Every key is used on its own,
+// so they may live in different Cluster slots.
+
+// classifyChange records the content hash of u's body for this run and
+// compares it with the one stored by earlier runs: "new" if u had none,
+// "changed" or "unchanged".
+func (r *RedisClient) classifyChange(ctx context.Context, u string, body []byte) (string, error) {
+	previous, err := r.client.HGet(ctx, r.key("page_hashes"), u).Result()
+	if err != nil && err != redis.Nil {
+		return "", err
+	}
+	known := err == nil
+
+	hash := contentHash(body)
+	change := changeNew
+	switch {
+	case known && previous == hash:
+		change = changeUnchanged
+	case known:
+		change = changeChanged
+	}
+
+	if err := r.client.HSet(ctx, r.key("page_hashes"), u, hash).Err(); err != nil {
+		return "", err
+	}
+	if err := r.client.SAdd(ctx, r.key("hashes_seen"), u).Err(); err != nil {
+		return "", err
+	}
+	return change, r.client.HIncrBy(ctx, r.key("change_counts"), change, 1).Err()
+}
+
+// finishChanges is the final diff of a completed run: every URL with a stored
+// hash that this run didn't hash is removed from page_hashes and returned,
+// sorted, and counted as "removed". The run's URLs are then forgotten, ready
+// for the next run.
+func (r *RedisClient) finishChanges(ctx context.Context) ([]string, error) {
+	stored, err := r.client.HKeys(ctx, r.key("page_hashes")).Result()
+	if err != nil {
+		return nil, err
+	}
+	seen, err := r.client.SMembers(ctx, r.key("hashes_seen")).Result()
+	if err != nil {
+		return nil, err
+	}
+	crawled := make(map[string]bool, len(seen))
+	for _, u := range seen {
+		crawled[u] = true
+	}
+	var removed []string
+	for _, u := range stored {
+		if !crawled[u] {
+			removed = append(removed, u)
+		}
+	}
+	sort.Strings(removed)
+
+	for start := 0; start < len(removed); start += 1000 {
+		batch := removed[start:min(start+1000, len(removed))]
+		if err := r.client.HDel(ctx, r.key("page_hashes"), batch...).Err(); err != nil {
+			return nil, err
+		}
+	}
+	if len(removed) > 0 {
+		if err := r.client.HIncrBy(ctx, r.key("change_counts"), changeRemoved, int64(len(removed))).Err(); err != nil {
+			return nil, err
+		}
+	}
+	return removed, r.client.Del(ctx, r.key("hashes_seen")).Err()
+}
+
+// changeCounts returns how many pages the run classified as each change.
+func (r *RedisClient) changeCounts(ctx context.Context) (map[string]int64, error) {
+	fields, err := r.client.HGetAll(ctx, r.key("change_counts")).Result()
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64, len(fields))
+	for change, n := range fields {
+		counts[change], _ = strconv.ParseInt(n, 10, 64)
+	}
+	return counts, nil
+}
+
+// detectChange classifies a fetched page for --detect-changes, returning ""
+// when it can't be: the fetch failed or the page has no body to hash.
+func (c *Crawler) detectChange(ctx context.Context, logger *slog.Logger, u string, page *Page, err error) string {
+	if !c.detectChanges || err != nil || page == nil || page.Body == nil {
+		return ""
+	}
+	change, err := c.redisClient.classifyChange(ctx, u, page.Body)
+	if err != nil {
+		logger.Warn("Redis error recording content hash", "error", err)
+		return ""
+	}
+	return change
+}
@@ -0,0 +1,26 @@
+package crawler
+
+import (
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+)
+
+// toUTF8 transcodes an HTML body to UTF-8 for parsing, returning it along with
+// the name of the encoding it was in. The encoding comes from a byte order
+// mark, the Content-Type charset, or a <meta charset> or http-equiv tag in
+// the first 1024 bytes. A body that declares nothing is taken as UTF-8 if it
+// is valid UTF-8, and as windows-1252 otherwise, as browsers do.
+func toUTF8(body []byte, contentType string) ([]byte, string) {
+	enc, name, certain := charset.DetermineEncoding(body, contentType)
+	// A guess or a <meta> tag is overruled by a body that is valid UTF-8
+	// throughout; the meta tag is often left over from a template
+	if name == "utf-8" || !certain && utf8.Valid(body) {
+		return body, "utf-8"
+	}
+	decoded, err := enc.NewDecoder().Bytes(body)
+	if err != nil {
+		return body, "utf-8"
+	}
+	return decoded, name
+}
@@ -0,0 +1,67 @@
+package crawler
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+)
+
+// recordValidators stores the ETag and Last-Modified of u's response in
+// validators:<id>:<u>, for conditional requests when it is recrawled.
+func (r *RedisClient) recordValidators(ctx context.Context, u string, header http.Header) error {
+	fields := make(map[string]interface{}, 2)
+	if etag := header.Get("ETag"); etag != "" {
+		fields["etag"] = etag
+	}
+	if modified := header.Get("Last-Modified"); modified != "" {
+		fields["last_modified"] = modified
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return r.client.HSet(ctx, r.urlKey("validators", u), fields).Err()
+}
+
+// validators returns the conditional request headers for u built from its
+// stored validators, or nil if none were stored.
+func (r *RedisClient) validators(ctx context.Context, u string) (http.Header, error) {
+	fields, err := r.client.HGetAll(ctx, r.urlKey("validators", u)).Result()
+	if err != nil || len(fields) == 0 {
+		return nil, err
+	}
+	header := make(http.Header)
+	if etag := fields["etag"]; etag != "" {
+		header.Set("If-None-Match", etag)
+	}
+	if modified := fields["last_modified"]; modified != "" {
+		header.Set("If-Modified-Since", modified)
+	}
+	return header, nil
+}
+
+// validatorsFor returns the conditional headers to recrawl u with. They are
+// only kept with --revisit-after, since otherwise a URL is fetched once.
+func (c *Crawler) validatorsFor(ctx context.Context, logger *slog.Logger, u string) http.Header {
+	if c.revisitAfter <= 0 {
+		return nil
+	}
+	header, err := c.redisClient.validators(ctx, u)
+	if err != nil {
+		logger.Warn("Redis error reading validators", "error", err)
+	}
+	return header
+}
+
+// followUnchanged handles a 304 on a recrawl: the page isn't processed again,
+// but the links recorded when it last changed are followed so the pages below
+// it are still revisited.
+func (c *Crawler) followUnchanged(ctx context.Context, logger *slog.Logger, item WorkItem) {
+	logger.Debug("Not modified since last crawl")
+	c.notModified.Add(1)
+	links, err := c.redisClient.client.SMembers(ctx, c.redisClient.urlKey("links", item.URL)).Result()
+	if err != nil {
+		logger.Warn("Redis error reading recorded links", "error", err)
+		return
+	}
+	c.followLinks(ctx, logger, item, links)
+}
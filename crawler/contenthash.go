@@ -0,0 +1,84 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"sync"
+)
+
+// contentHash hashes a page body with its whitespace collapsed, so pages
+// that differ only in indentation or line endings hash the same.
+func contentHash(body []byte) string {
+	sum := sha256.Sum256(bytes.Join(bytes.Fields(body), []byte(" ")))
+	return hex.EncodeToString(sum[:])
+}
+
+// contentHashes remembers the body hash of every page crawled, so pages
+// served again under another URL, such as mirrors and print views, aren't
+// processed twice. Hashes are kept in the content_hashes:<id> Redis set and
+// the URLs skipped as duplicates in the content_dupes:<id> hash, from URL to
+// hash; without Redis both are only kept in process. A nil contentHashes
+// (content dedup off) reports nothing as a duplicate.
+type contentHashes struct {
+	redisClient *RedisClient
+
+	mu     sync.Mutex
+	hashes map[string]bool
+	dupes  map[string]string
+}
+
+func newContentHashes(redisClient *RedisClient) *contentHashes {
+	return &contentHashes{
+		redisClient: redisClient,
+		hashes:      make(map[string]bool),
+		dupes:       make(map[string]string),
+	}
+}
+
+// seen records the hash of u's body and reports whether another page had
+// already been crawled with the same content; u is then recorded as a
+// duplicate. On a Redis error the page is kept, like duplicateOf does.
+func (h *contentHashes) seen(ctx context.Context, u string, body []byte) (bool, error) {
+	if h == nil || body == nil {
+		return false, nil
+	}
+	hash := contentHash(body)
+	if h.redisClient == nil {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if !h.hashes[hash] {
+			h.hashes[hash] = true
+			return false, nil
+		}
+		h.dupes[u] = hash
+		return true, nil
+	}
+
+	added, err := h.redisClient.client.SAdd(ctx, h.redisClient.key("content_hashes"), hash).Result()
+	if err != nil || added == 1 {
+		return false, err
+	}
+	return true, h.redisClient.client.HSet(ctx, h.redisClient.key("content_dupes"), u, hash).Err()
+}
+
+// duplicates returns the URLs skipped as content duplicates, sorted.
+func (h *contentHashes) duplicates(ctx context.Context) ([]string, error) {
+	var urls []string
+	if h.redisClient == nil {
+		h.mu.Lock()
+		for u := range h.dupes {
+			urls = append(urls, u)
+		}
+		h.mu.Unlock()
+	} else {
+		var err error
+		if urls, err = h.redisClient.client.HKeys(ctx, h.redisClient.key("content_dupes")).Result(); err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(urls)
+	return urls, nil
+}
@@ -0,0 +1,130 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// newCookieJar returns an empty jar that keeps cookies scoped to their
+// registrable domain. cookiejar.Jar is safe for concurrent use by workers.
+func newCookieJar() http.CookieJar {
+	jar, _ := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	return jar
+}
+
+// jsonCookie is one entry of a browser-extension cookie export.
+type jsonCookie struct {
+	Name           string  `json:"name"`
+	Value          string  `json:"value"`
+	Domain         string  `json:"domain"`
+	Path           string  `json:"path"`
+	Secure         bool    `json:"secure"`
+	HTTPOnly       bool    `json:"httpOnly"`
+	HostOnly       bool    `json:"hostOnly"`
+	ExpirationDate float64 `json:"expirationDate"`
+}
+
+// LoadCookies reads a cookie file into a new jar. Both the Netscape
+// cookies.txt format and a JSON array of {name, value, domain, path, secure,
+// httpOnly, hostOnly, expirationDate} objects are accepted.
+func LoadCookies(path string) (http.CookieJar, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	jar := newCookieJar()
+
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		var entries []jsonCookie
+		if err := json.Unmarshal(trimmed, &entries); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+		for _, e := range entries {
+			cookie := &http.Cookie{Name: e.Name, Value: e.Value, Path: e.Path, Secure: e.Secure, HttpOnly: e.HTTPOnly}
+			if e.ExpirationDate > 0 {
+				cookie.Expires = time.Unix(int64(e.ExpirationDate), 0)
+			}
+			setCookie(jar, e.Domain, !e.HostOnly, cookie)
+		}
+		return jar, nil
+	}
+
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		httpOnly := false
+		if rest, ok := strings.CutPrefix(line, "#HttpOnly_"); ok {
+			line, httpOnly = rest, true
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// domain, include subdomains, path, secure, expiry, name, value
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("%s:%d: expected 7 tab-separated fields, got %d", path, i+1, len(fields))
+		}
+		cookie := &http.Cookie{
+			Name:     fields[5],
+			Value:    fields[6],
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			HttpOnly: httpOnly,
+		}
+		if expiry, err := strconv.ParseInt(fields[4], 10, 64); err == nil && expiry > 0 {
+			cookie.Expires = time.Unix(expiry, 0)
+		}
+		setCookie(jar, fields[0], strings.EqualFold(fields[1], "TRUE"), cookie)
+	}
+	return jar, nil
+}
+
+// setCookie stores cookie for domain. Host-only cookies are sent to that exact
+// host; the others also go to its subdomains.
+func setCookie(jar http.CookieJar, domain string, subdomains bool, cookie *http.Cookie) {
+	host := strings.TrimPrefix(domain, ".")
+	if host == "" {
+		return
+	}
+	if subdomains {
+		cookie.Domain = host
+	}
+	scheme := "http"
+	if cookie.Secure {
+		scheme = "https"
+	}
+	jar.SetCookies(&url.URL{Scheme: scheme, Host: host, Path: "/"}, []*http.Cookie{cookie})
+}
+
+// login posts form to loginURL with the shared client so the session cookies
+// it sets land in the jar before the first page is fetched.
+func (c *Crawler) login(ctx context.Context, loginURL string, form url.Values) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", loginURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", c.fetchOpts.headers.Get("User-Agent"))
+
+	resp, err := c.fetchOpts.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("status error: %d", resp.StatusCode)
+	}
+	return nil
+}
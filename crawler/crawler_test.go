@@ -0,0 +1,339 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// serveSite serves pages, keyed by path, as HTML. Every other path is a 404.
+func serveSite(t *testing.T, pages map[string]string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// links is an HTML page linking to hrefs, in order.
+func links(hrefs ...string) string {
+	page := "<html><body>"
+	for _, href := range hrefs {
+		page += fmt.Sprintf(`<a href="%s">%s</a>`, href, href)
+	}
+	return page + "</body></html>"
+}
+
+// memoryConfig is DefaultConfig for an in-process crawl of seed that streams
+// its results.
+func memoryConfig(seed string) Config {
+	cfg := DefaultConfig()
+	cfg.SeedURL = seed
+	cfg.Backend = "memory"
+	cfg.IgnoreRobots = true
+	cfg.StreamResults = true
+	cfg.HTTPTimeout = 5 * time.Second
+	return cfg
+}
+
+// crawl runs cfg to completion and returns the results it streamed, in the
+// order they were produced.
+func crawl(t *testing.T, cfg Config) []PageResult {
+	t.Helper()
+	c, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close()
+
+	var results []PageResult
+	collected := make(chan struct{})
+	go func() {
+		defer close(collected)
+		for result := range c.Results() {
+			results = append(results, result)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if _, err := c.Start(ctx); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	<-collected
+	return results
+}
+
+// depthsByURL maps each result's URL to its depth.
+func depthsByURL(results []PageResult) map[string]int {
+	depths := make(map[string]int, len(results))
+	for _, result := range results {
+		depths[result.URL] = result.Depth
+	}
+	return depths
+}
+
+func TestCrawlDepthLimit(t *testing.T) {
+	site := serveSite(t, map[string]string{
+		"/":  links("/a", "/b"),
+		"/a": links("/c"),
+		"/b": links("/a", "/e"),
+		"/c": links("/d"),
+		"/d": links("/f"),
+		"/e": links(),
+	})
+	cfg := memoryConfig(site.URL + "/")
+	cfg.MaxDepth = 2
+
+	got := depthsByURL(crawl(t, cfg))
+	want := map[string]int{
+		site.URL + "/":  0,
+		site.URL + "/a": 1,
+		site.URL + "/b": 1,
+		site.URL + "/c": 2,
+		site.URL + "/e": 2,
+	}
+	if len(got) != len(want) {
+		t.Errorf("crawled %v, want %v", sortedKeys(got), sortedKeys(want))
+	}
+	for u, depth := range want {
+		if d, ok := got[u]; !ok {
+			t.Errorf("%s not crawled", u)
+		} else if d != depth {
+			t.Errorf("%s crawled at depth %d, want %d", u, d, depth)
+		}
+	}
+}
+
+func TestCrawlDepthZeroFetchesOnlySeed(t *testing.T) {
+	site := serveSite(t, map[string]string{
+		"/":  links("/a"),
+		"/a": links(),
+	})
+	cfg := memoryConfig(site.URL + "/")
+	cfg.MaxDepth = 0
+
+	got := depthsByURL(crawl(t, cfg))
+	if depth, ok := got[site.URL+"/"]; len(got) != 1 || !ok || depth != 0 {
+		t.Errorf("crawled %v, want only the seed", got)
+	}
+}
+
+// A job another tool pushes without a depth starts at depth 0, like a seed,
+// so its links are followed.
+func TestCrawlJobWithoutDepth(t *testing.T) {
+	site := serveSite(t, map[string]string{
+		"/":  links("/a"),
+		"/a": links("/b"),
+		"/b": links(),
+	})
+	r, redisServer := newTestRedis(t)
+	if _, err := redisServer.ZAdd(r.key("jobs"), 0, fmt.Sprintf(`{"url":%q}`, site.URL+"/")); err != nil {
+		t.Fatalf("ZADD: %v", err)
+	}
+
+	cfg := memoryConfig("")
+	cfg.Backend = "redis"
+	cfg.RedisAddr = redisServer.Addr()
+	cfg.JobID = r.jobID
+	cfg.WorkerOnly = true
+	cfg.MaxDepth = 1
+
+	got := depthsByURL(crawl(t, cfg))
+	want := map[string]int{site.URL + "/": 0, site.URL + "/a": 1}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("crawled %v, want %v", got, want)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// With one worker a BFS crawl visits pages level by level, each page's links
+// in document order, and does so the same way on every run and backend.
+func TestCrawlOrderSingleWorker(t *testing.T) {
+	site := serveSite(t, map[string]string{
+		"/":   links("/m", "/b", "/z"),
+		"/m":  links("/m2", "/a1"),
+		"/b":  links("/m", "/b1"),
+		"/z":  links("/z1", "/a1"),
+		"/m2": links(),
+		"/a1": links(),
+		"/b1": links(),
+		"/z1": links(),
+	})
+	var want []string
+	for _, path := range []string{"/", "/m", "/b", "/z", "/m2", "/a1", "/b1", "/z1"} {
+		want = append(want, site.URL+path)
+	}
+
+	for _, backend := range []string{"memory", "redis"} {
+		t.Run(backend, func(t *testing.T) {
+			for run := range 2 {
+				cfg := memoryConfig(site.URL + "/")
+				cfg.Workers = 1
+				cfg.Strategy = "bfs"
+				if backend == "redis" {
+					cfg.Backend = "redis"
+					cfg.RedisAddr = miniredis.RunT(t).Addr()
+				}
+				var got []string
+				for _, result := range crawl(t, cfg) {
+					got = append(got, result.URL)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Fatalf("run %d visited %q, want %q", run, got, want)
+				}
+			}
+		})
+	}
+}
+
+// Stopping the crawl cuts short the fetches in progress and puts their jobs
+// back on the queue, instead of waiting them out or losing them.
+func TestCancelRequeuesFetchInProgress(t *testing.T) {
+	fetching := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			fmt.Fprint(w, links("/slow"))
+			return
+		}
+		close(fetching)
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	r, redisServer := newTestRedis(t)
+
+	cfg := memoryConfig(server.URL + "/")
+	cfg.Backend = "redis"
+	cfg.RedisAddr = redisServer.Addr()
+	cfg.JobID = r.jobID
+	cfg.Workers = 1
+	cfg.HTTPTimeout = time.Minute
+	cfg.StreamResults = false
+	c, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Start(ctx)
+	}()
+	select {
+	case <-fetching:
+	case <-time.After(10 * time.Second):
+		t.Fatal("slow page never fetched")
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start didn't return after ctx was cancelled")
+	}
+
+	item, err := r.Pop(context.Background(), time.Second)
+	if err != nil || item.URL != server.URL+"/slow" || item.Attempt != 0 {
+		t.Errorf("queued job = %+v, %v; want %s/slow at attempt 0", item, err, server.URL)
+	}
+}
+
+// Interrupting a crawl loses no page: every URL marked visited was either
+// crawled or is back on the queue for --resume, whether its job was being
+// fetched or waiting out the host's delay when the crawl was stopped.
+func TestCancelPutsPoppedJobsBack(t *testing.T) {
+	pages := make(map[string]string)
+	var hrefs []string
+	for i := range 40 {
+		path := fmt.Sprintf("/p/%d", i)
+		hrefs = append(hrefs, path)
+		pages[path] = links()
+	}
+	pages["/"] = links(hrefs...)
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(20 * time.Millisecond):
+		case <-r.Context().Done():
+			return
+		}
+		fmt.Fprint(w, pages[r.URL.Path])
+	}))
+	defer site.Close()
+	r, redisServer := newTestRedis(t)
+
+	cfg := memoryConfig(site.URL + "/")
+	cfg.Backend = "redis"
+	cfg.RedisAddr = redisServer.Addr()
+	cfg.JobID = r.jobID
+	cfg.Workers = 8
+	cfg.Delay = 50 * time.Millisecond
+	c, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close()
+
+	crawled := make(map[string]bool)
+	collected := make(chan struct{})
+	go func() {
+		defer close(collected)
+		for result := range c.Results() {
+			crawled[result.URL] = true
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 400*time.Millisecond)
+	defer cancel()
+	if _, err := c.Start(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Start = %v, want it interrupted", err)
+	}
+	<-collected
+
+	bg := context.Background()
+	queued := make(map[string]bool)
+	for {
+		item, err := r.Pop(bg, time.Second)
+		if err == ErrQueueEmpty {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Pop: %v", err)
+		}
+		queued[item.URL] = true
+	}
+	if len(crawled) == 0 || len(queued) == 0 {
+		t.Fatalf("crawled %d and queued %d pages, want the crawl stopped partway", len(crawled), len(queued))
+	}
+	visited, err := r.client.SMembers(bg, r.key("visited")).Result()
+	if err != nil {
+		t.Fatalf("SMEMBERS visited: %v", err)
+	}
+	for _, u := range visited {
+		if !crawled[u] && !queued[u] {
+			t.Errorf("%s marked visited but neither crawled nor queued", u)
+		}
+	}
+}
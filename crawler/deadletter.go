@@ -0,0 +1,87 @@
+package crawler
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Jobs that use up their MaxRetries re-queues are moved to the jobs_dead:<id>
+// list as JSON Jobs, with Error saying why, instead of being dropped. They
+// can be inspected with LRANGE and put back on the queue with RequeueDead.
+
+// pushDead appends item to the job's dead-letter list.
+func (r *RedisClient) pushDead(ctx context.Context, item WorkItem, reason string) error {
+	job := newJob(item)
+	job.Error = reason
+	data, err := encodeJob(job)
+	if err != nil {
+		return err
+	}
+	return retry(ctx, "push_dead", func() error {
+		return r.client.RPush(ctx, r.key("jobs_dead"), data).Err()
+	})
+}
+
+// DeadJobs returns how many jobs are in the dead-letter list.
+func (r *RedisClient) DeadJobs(ctx context.Context) (int64, error) {
+	return r.client.LLen(ctx, r.key("jobs_dead")).Result()
+}
+
+// deadLetter moves item, which used up its re-queues, to the dead-letter
+// list. Without Redis it is only dropped.
+func (c *Crawler) deadLetter(ctx context.Context, logger *slog.Logger, item WorkItem, reason string) {
+	if c.redisClient == nil {
+		return
+	}
+	if err := c.redisClient.pushDead(ctx, item, reason); err != nil {
+		logger.Error("Redis error moving job to dead-letter list", "error", err)
+		return
+	}
+	deadJobs.Inc()
+	logger.Info("Moved job to dead-letter list", "list", c.redisClient.key("jobs_dead"), "reason", reason)
+}
+
+// RequeueDead connects to the Redis server cfg describes and moves every job
+// in the dead-letter list of cfg.JobID back onto its queue, with its attempts
+// and deferrals reset, returning how many were moved. The jobs are still
+// marked visited, so they are pushed straight to the queue; a --resume run of
+// the job, or its daemon and worker-only processes, then crawl them again.
+func RequeueDead(ctx context.Context, cfg Config) (int, error) {
+	opts, err := cfg.redisOptions()
+	if err != nil {
+		return 0, err
+	}
+	redisClient, err := NewRedisClient(cfg.RedisMode, opts, cfg.JobID, cfg.RedisConnectTimeout)
+	if err != nil {
+		return 0, err
+	}
+	defer redisClient.CloseConnection()
+
+	moved := 0
+	for {
+		data, err := redisClient.client.LPop(ctx, redisClient.key("jobs_dead")).Result()
+		if err == redis.Nil {
+			return moved, nil
+		}
+		if err != nil {
+			return moved, err
+		}
+		item, err := decodeJob(data)
+		if err != nil {
+			slog.Warn("Dropped malformed dead-letter job", "error", err)
+			continue
+		}
+		item.Attempt = 0
+		item.Deferrals = 0
+		if _, err := redisClient.Push(ctx, item, strategyPriority(cfg.Strategy, item.Depth)); err != nil {
+			// Put it back rather than lose it
+			if err := redisClient.client.LPush(ctx, redisClient.key("jobs_dead"), data).Err(); err != nil {
+				slog.Error("Redis error restoring dead-letter job", "job", data, "error", err)
+			}
+			return moved, err
+		}
+		moved++
+	}
+}
@@ -0,0 +1,105 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// dropConnection closes the client's connection without a response. Servers
+// using it disable keep-alives, so the client can't take the dropped request
+// for a stale connection and quietly retry it.
+func dropConnection(w http.ResponseWriter) {
+	conn, _, err := http.NewResponseController(w).Hijack()
+	if err == nil {
+		conn.Close()
+	}
+}
+
+// Fetches that get no response are re-queued like rate-limited ones, and
+// once they have used up MaxRetries they go to the dead-letter list, as
+// versioned jobs with the reason.
+func TestFetchFailuresDeadLettered(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(links("/dropped", "/slow")))
+		case "/dropped":
+			dropConnection(w)
+		case "/slow":
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		}
+	}))
+	server.Config.SetKeepAlivesEnabled(false)
+	defer server.Close()
+	r, redisServer := newTestRedis(t)
+
+	cfg := memoryConfig(server.URL + "/")
+	cfg.Backend = "redis"
+	cfg.RedisAddr = redisServer.Addr()
+	cfg.JobID = r.jobID
+	cfg.HTTPTimeout = 100 * time.Millisecond
+	cfg.MaxRetries = 2
+	results := crawl(t, cfg)
+
+	attempts := map[string]int{}
+	for _, result := range results {
+		attempts[result.URL]++
+	}
+	for _, path := range []string{"/dropped", "/slow"} {
+		if n := attempts[server.URL+path]; n != cfg.MaxRetries+1 {
+			t.Errorf("%s fetched %d times, want %d", path, n, cfg.MaxRetries+1)
+		}
+	}
+
+	dead, err := r.client.LRange(context.Background(), r.key("jobs_dead"), 0, -1).Result()
+	if err != nil {
+		t.Fatalf("LRANGE jobs_dead: %v", err)
+	}
+	reasons := map[string]string{}
+	for _, data := range dead {
+		var job Job
+		if err := json.Unmarshal([]byte(data), &job); err != nil {
+			t.Fatalf("dead job %s: %v", data, err)
+		}
+		if job.Version != JobVersion || job.Attempt != cfg.MaxRetries {
+			t.Errorf("dead job %s: want version %d and attempt %d", data, JobVersion, cfg.MaxRetries)
+		}
+		reasons[job.URL] = job.Error
+	}
+	want := map[string]string{server.URL + "/dropped": "network error", server.URL + "/slow": "timeout"}
+	if len(reasons) != len(want) || reasons[server.URL+"/dropped"] != want[server.URL+"/dropped"] || reasons[server.URL+"/slow"] != want[server.URL+"/slow"] {
+		t.Errorf("dead-letter reasons = %v, want %v", reasons, want)
+	}
+}
+
+// A URL whose connection failed once is crawled on its re-queue.
+func TestFetchFailureRetried(t *testing.T) {
+	var failed atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/flaky" && !failed.Swap(true) {
+			dropConnection(w)
+			return
+		}
+		w.Write([]byte(links("/flaky")))
+	}))
+	server.Config.SetKeepAlivesEnabled(false)
+	defer server.Close()
+
+	var last PageResult
+	for _, result := range crawl(t, memoryConfig(server.URL+"/")) {
+		if result.URL == server.URL+"/flaky" {
+			last = result
+		}
+	}
+	if last.Error != "" || last.Attempt != 1 {
+		t.Errorf("last fetch of /flaky = attempt %d, error %q; want attempt 1 without error", last.Attempt, last.Error)
+	}
+}
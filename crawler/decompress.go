@@ -0,0 +1,61 @@
+package crawler
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// acceptEncoding is advertised on page requests. Setting it ourselves turns off
+// Go's transparent gzip handling, so decodeBody must handle every coding listed.
+const acceptEncoding = "gzip, deflate, br"
+
+// decodeBody wraps resp.Body in decoders for each Content-Encoding applied,
+// outermost last. Bodies the transport already decompressed are returned as-is.
+func decodeBody(resp *http.Response) (io.Reader, error) {
+	var body io.Reader = resp.Body
+	if resp.Uncompressed {
+		return body, nil
+	}
+
+	codings := strings.Split(resp.Header.Get("Content-Encoding"), ",")
+	// Encodings are listed in the order they were applied, so undo them in reverse
+	for i := len(codings) - 1; i >= 0; i-- {
+		coding := strings.ToLower(strings.TrimSpace(codings[i]))
+		switch coding {
+		case "", "identity":
+		case "gzip", "x-gzip":
+			gz, err := gzip.NewReader(body)
+			if err != nil {
+				return nil, fmt.Errorf("gzip body: %w", err)
+			}
+			body = gz
+		case "deflate":
+			body = inflate(body)
+		case "br":
+			body = brotli.NewReader(body)
+		default:
+			return nil, fmt.Errorf("unsupported Content-Encoding %q", coding)
+		}
+	}
+	return body, nil
+}
+
+// inflate decodes a "deflate" body. The spec says zlib-wrapped, but plenty of
+// servers send a raw DEFLATE stream, so sniff the zlib header first.
+func inflate(r io.Reader) io.Reader {
+	br := bufio.NewReader(r)
+	if header, err := br.Peek(2); err == nil && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		if z, err := zlib.NewReader(br); err == nil {
+			return z
+		}
+	}
+	return flate.NewReader(br)
+}
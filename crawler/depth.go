@@ -0,0 +1,54 @@
+package crawler
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// depthLimits holds the per-host DepthOverrides, keyed by lowercase host
+// pattern, with MaxDepth for hosts no pattern matches.
+type depthLimits struct {
+	fallback  int
+	overrides map[string]int
+	// deepest is the largest limit, past which no link is followed
+	deepest int
+}
+
+func newDepthLimits(maxDepth int, overrides map[string]int) depthLimits {
+	d := depthLimits{fallback: maxDepth, overrides: make(map[string]int, len(overrides)), deepest: maxDepth}
+	for pattern, depth := range overrides {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		// Allow entries to be written with a port, like --allow-domains
+		if host, _, err := net.SplitHostPort(pattern); err == nil {
+			pattern = host
+		}
+		d.overrides[pattern] = depth
+		d.deepest = max(d.deepest, depth)
+	}
+	return d
+}
+
+// forURL returns the depth limit for rawURL's host: that of the most specific
+// matching override, or the fallback. An exact host beats a "*." pattern, and
+// a longer "*." pattern beats a shorter one.
+func (d depthLimits) forURL(rawURL string) int {
+	if len(d.overrides) == 0 {
+		return d.fallback
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return d.fallback
+	}
+	host := strings.ToLower(u.Hostname())
+	if depth, ok := d.overrides[host]; ok {
+		return depth
+	}
+	limit, longest := d.fallback, 0
+	for pattern, depth := range d.overrides {
+		if strings.HasPrefix(pattern, "*.") && len(pattern) > longest && matchHost(pattern, host) {
+			limit, longest = depth, len(pattern)
+		}
+	}
+	return limit
+}
@@ -0,0 +1,486 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// fetchOptions controls how extractLinks requests and parses a page.
+type fetchOptions struct {
+	// client is shared by all workers so connections are pooled
+	client *http.Client
+	// fetch sends page requests through any registered middleware; when nil
+	// client is used directly
+	fetch Fetcher
+	// headers are sent with every page request, including User-Agent
+	headers http.Header
+	// validators are conditional headers (If-None-Match, If-Modified-Since)
+	// sent with the first request only, not with meta-refresh hops
+	validators http.Header
+	// maxLinks caps the links returned per page; 0 means unlimited
+	maxLinks int
+	// contentTypes lists the media types parsed for links, e.g. "text/html"
+	contentTypes []string
+	// maxBodyBytes caps how much of a response body is read; 0 means unlimited
+	maxBodyBytes int64
+	// maxRedirects caps meta-refresh hops followed per fetch
+	maxRedirects int
+	// verbose keeps the hrefs that were dropped for their scheme
+	verbose bool
+	// linkAttrs maps extra elements to follow, beyond <a>, to the attribute
+	// holding their URL, e.g. "iframe" -> "src"
+	linkAttrs map[string]string
+	// respectNofollow drops links marked rel="nofollow", and every link on a
+	// page whose robots directives say nofollow
+	respectNofollow bool
+	// postPatterns match the URLs fetched by POSTing postBody instead of GET
+	postPatterns []*regexp.Regexp
+	postBody     string
+	// extractors pull the Extract fields out of every parsed page
+	extractors []extractor
+}
+
+// posts reports whether u is fetched with a POST.
+func (o fetchOptions) posts(u string) bool {
+	for _, re := range o.postPatterns {
+		if re.MatchString(u) {
+			return true
+		}
+	}
+	return false
+}
+
+// compilePostPatterns compiles the --post-pattern regexps, failing on the
+// first invalid one.
+func compilePostPatterns(patterns []string) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --post-pattern %q: %w", p, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// Page is the result of fetching and parsing a single URL.
+type Page struct {
+	Status int
+	// FinalURL is the URL after following HTTP redirects
+	FinalURL string
+	// Canonical is the resolved <link rel="canonical"> href, if any
+	Canonical string
+	// Refresh is the resolved target of a <meta http-equiv="refresh">, if any
+	Refresh     string
+	ContentType string
+	// Charset is the encoding the body was decoded from for parsing, e.g.
+	// "shift_jis"; Body keeps the bytes as served
+	Charset string
+	// Header holds the response headers of a successful fetch
+	Header      http.Header
+	Title       string
+	Description string
+	Links       []string
+	// Unfollowable lists hrefs dropped for their scheme (mailto:, tel:, ...);
+	// it is only filled in when verbose is set
+	Unfollowable []string
+	// Nofollow lists links dropped for rel="nofollow" or a page-level nofollow
+	// directive; it is only filled in when respectNofollow is set
+	Nofollow []string
+	// NoIndex is set when a robots <meta> tag or X-Robots-Tag header says noindex
+	NoIndex bool
+	// Extracted holds the text matched by each Extract selector, by field name
+	Extracted map[string]string
+	Body      []byte
+	// Truncated is set when the body was cut off at maxBodyBytes
+	Truncated bool
+	// TooLarge is set when the Content-Length was over maxBodyBytes, so the
+	// body wasn't read at all
+	TooLarge bool
+}
+
+func extractLinks(ctx context.Context, baseTarget, referer string, opts fetchOptions) (*Page, error) {
+	method, payload := http.MethodGet, io.Reader(nil)
+	post := opts.posts(baseTarget)
+	if post {
+		method, payload = http.MethodPost, strings.NewReader(opts.postBody)
+	}
+	req, err := http.NewRequest(method, baseTarget, payload)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+	for key, values := range opts.headers {
+		for _, v := range values {
+			req.Header.Add(key, v)
+		}
+	}
+	if post && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	// A POST isn't conditional; the response is always a fresh one
+	if !post {
+		for key, values := range opts.validators {
+			for _, v := range values {
+				req.Header.Add(key, v)
+			}
+		}
+	}
+	if sendReferer(referer, req.URL) && req.Header.Get("Referer") == "" {
+		req.Header.Set("Referer", referer)
+	}
+
+	send := opts.fetch
+	if send == nil {
+		send = opts.client.Do
+	}
+	resp, err := send(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		return &Page{Status: resp.StatusCode}, &retryAfterError{
+			status: resp.StatusCode,
+			delay:  parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
+	}
+
+	// Only a conditional request can get a 304; the stored copy is current
+	if resp.StatusCode == http.StatusNotModified && opts.validators != nil && !post {
+		return &Page{Status: resp.StatusCode, FinalURL: resp.Request.URL.String(), Header: resp.Header}, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return &Page{Status: resp.StatusCode}, fmt.Errorf("status error: %d", resp.StatusCode)
+	}
+
+	// Don't waste time parsing PDFs, images, JSON, etc. for links
+	contentType := mediaType(resp.Header.Get("Content-Type"))
+	if !opts.parses(contentType) {
+		return &Page{Status: resp.StatusCode, FinalURL: resp.Request.URL.String(), ContentType: contentType, Header: resp.Header}, nil
+	}
+
+	// Don't download a body the server says is over the limit. Bodies of
+	// unknown length, such as chunked ones, are capped by the LimitReader below.
+	if opts.maxBodyBytes > 0 && resp.ContentLength > opts.maxBodyBytes {
+		return &Page{Status: resp.StatusCode, FinalURL: resp.Request.URL.String(), ContentType: contentType, Header: resp.Header, TooLarge: true}, nil
+	}
+
+	// Resolve relative links (e.g., "/about" -> "https://site.com/about") against
+	// the URL we ended up at after redirects, not the one we asked for
+	base := resp.Request.URL
+
+	reader, err := decodeBody(resp)
+	if err != nil {
+		return nil, err
+	}
+	if opts.maxBodyBytes > 0 {
+		// Read one byte past the limit so we can tell a truncated body from one
+		// that is exactly maxBodyBytes long. The limit applies to decoded bytes,
+		// which also guards against compression bombs.
+		reader = io.LimitReader(reader, opts.maxBodyBytes+1)
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	truncated := opts.maxBodyBytes > 0 && int64(len(body)) > opts.maxBodyBytes
+	if truncated {
+		body = body[:opts.maxBodyBytes]
+	}
+
+	// Parse UTF-8, but keep the body as served for storage
+	decoded, charset := toUTF8(body, resp.Header.Get("Content-Type"))
+	doc, err := html.Parse(bytes.NewReader(decoded))
+	if err != nil {
+		return nil, err
+	}
+
+	page := &Page{Status: resp.StatusCode, FinalURL: base.String(), ContentType: contentType, Charset: charset, Header: resp.Header, Body: body, Truncated: truncated}
+	if len(opts.extractors) > 0 {
+		page.Extracted = extractFields(doc, opts.extractors)
+	}
+	noindex, nofollowAll := robotsDirectives(resp.Header.Values("X-Robots-Tag"))
+	page.NoIndex = noindex
+	// A <base href> changes what every relative link in the document resolves
+	// against, including links that come before it, so it's looked up before
+	// the walk.
+	if href, ok := baseHref(doc); ok {
+		if u, err := url.Parse(strings.TrimSpace(href)); err == nil {
+			base = base.ResolveReference(u)
+		}
+	}
+	// ITERATIVE STACK: We manage the stack ourselves to prevent deep recursion issues
+	// We pre-allocate a small slice to hold nodes
+	stack := make([]*html.Node, 0, 50)
+	stack = append(stack, doc)
+
+	for len(stack) > 0 {
+		// Pop the last node
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "a":
+				if href, ok := attr(n, "href"); ok {
+					resolved := resolveURL(base, href)
+					if resolved != "" {
+						page.addLink(resolved, opts.respectNofollow && relNofollow(n))
+					} else if opts.verbose {
+						page.Unfollowable = append(page.Unfollowable, href)
+					}
+				}
+			case "link":
+				rel, _ := attr(n, "rel")
+				if page.Canonical == "" && hasToken(rel, "canonical") {
+					if href, ok := attr(n, "href"); ok {
+						page.Canonical = resolveURL(base, href)
+					}
+				}
+			case "title":
+				// Skip <title> elements that belong to inline SVG
+				if page.Title == "" && n.Namespace == "" {
+					page.Title = strings.TrimSpace(textContent(n))
+				}
+			case "meta":
+				if name, _ := attr(n, "name"); strings.EqualFold(name, "description") && page.Description == "" {
+					content, _ := attr(n, "content")
+					page.Description = strings.TrimSpace(content)
+				}
+				if name, _ := attr(n, "name"); strings.EqualFold(name, "robots") {
+					content, _ := attr(n, "content")
+					noindex, nofollow := robotsDirectives([]string{content})
+					page.NoIndex = page.NoIndex || noindex
+					nofollowAll = nofollowAll || nofollow
+				}
+				if equiv, _ := attr(n, "http-equiv"); strings.EqualFold(equiv, "refresh") && page.Refresh == "" {
+					content, _ := attr(n, "content")
+					if target := parseRefresh(content); target != "" {
+						page.Refresh = resolveURL(base, target)
+					}
+				}
+			}
+			if key, ok := opts.linkAttrs[n.Data]; ok && followable(n) {
+				if href, ok := attr(n, key); ok {
+					if resolved := resolveURL(base, href); resolved != "" {
+						page.addLink(resolved, opts.respectNofollow && relNofollow(n))
+					}
+				}
+			}
+		}
+
+		// Add children to the stack last first, so they are popped, and their
+		// links found, in document order
+		for c := n.LastChild; c != nil; c = c.PrevSibling {
+			stack = append(stack, c)
+		}
+	}
+
+	// A page-level nofollow may be found after some of its links were taken
+	if opts.respectNofollow && nofollowAll {
+		page.Nofollow = append(page.Nofollow, page.Links...)
+		page.Links = nil
+	}
+
+	// Apply the cap only after the whole document is walked so the kept
+	// links, the first ones in the document, don't depend on where the
+	// traversal happened to stop
+	if opts.maxLinks > 0 && len(page.Links) > opts.maxLinks {
+		page.Links = page.Links[:opts.maxLinks]
+	}
+
+	return page, nil
+}
+
+// addLink adds a followable link to the page, or to Nofollow if nofollow is set.
+func (p *Page) addLink(link string, nofollow bool) {
+	if nofollow {
+		p.Nofollow = append(p.Nofollow, link)
+		return
+	}
+	p.Links = append(p.Links, link)
+}
+
+// relNofollow reports whether a link element is marked rel="nofollow".
+func relNofollow(n *html.Node) bool {
+	rel, _ := attr(n, "rel")
+	return hasToken(rel, "nofollow")
+}
+
+// robotsDirectives reads noindex and nofollow from robots <meta> content or
+// X-Robots-Tag values such as "noindex, nofollow". "none" means both.
+// Directives scoped to a named bot ("googlebot: noindex") are ignored.
+func robotsDirectives(values []string) (noindex, nofollow bool) {
+	for _, v := range values {
+		if strings.Contains(v, ":") {
+			continue
+		}
+		for _, d := range strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' }) {
+			switch strings.ToLower(d) {
+			case "noindex":
+				noindex = true
+			case "nofollow":
+				nofollow = true
+			case "none":
+				noindex, nofollow = true, true
+			}
+		}
+	}
+	return noindex, nofollow
+}
+
+// sendReferer reports whether referer may be sent with a request to target.
+// Like browsers, an https page's URL isn't sent to a plain http one.
+func sendReferer(referer string, target *url.URL) bool {
+	if referer == "" {
+		return false
+	}
+	return !strings.HasPrefix(referer, "https:") || target.Scheme == "https"
+}
+
+// baseHref returns the href of the document's first <base> element that has
+// one, as HTML specifies.
+func baseHref(doc *html.Node) (string, bool) {
+	if doc.Type == html.ElementNode && doc.Data == "base" {
+		if href, ok := attr(doc, "href"); ok {
+			return href, true
+		}
+	}
+	for c := doc.FirstChild; c != nil; c = c.NextSibling {
+		if href, ok := baseHref(c); ok {
+			return href, true
+		}
+	}
+	return "", false
+}
+
+// followable reports whether an opted-in link element leads to a page a GET
+// can fetch. Forms that POST are skipped since their action expects a body.
+func followable(n *html.Node) bool {
+	if n.Data == "form" {
+		method, _ := attr(n, "method")
+		return method == "" || strings.EqualFold(method, "get")
+	}
+	return true
+}
+
+// hasToken reports whether the space-separated list contains token, ignoring case.
+func hasToken(list, token string) bool {
+	for _, t := range strings.Fields(list) {
+		if strings.EqualFold(t, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// attr returns the value of the named attribute on n.
+func attr(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// textContent concatenates the text nodes beneath n.
+func textContent(n *html.Node) string {
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.TextNode {
+			b.WriteString(c.Data)
+		} else {
+			b.WriteString(textContent(c))
+		}
+	}
+	return b.String()
+}
+
+// parses reports whether pages of the given media type should be parsed.
+// Responses without a Content-Type are parsed, since HTML is the likely case.
+func (o fetchOptions) parses(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	for _, t := range o.contentTypes {
+		if strings.EqualFold(t, contentType) {
+			return true
+		}
+	}
+	return false
+}
+
+// mediaType returns the lowercase media type of a Content-Type header,
+// without parameters such as charset.
+func mediaType(header string) string {
+	if header == "" {
+		return ""
+	}
+	mt, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(strings.Split(header, ";")[0]))
+	}
+	return mt
+}
+
+// resolveURL resolves href against base, returning "" for links that can't be
+// crawled (unparseable, or a scheme such as mailto:, tel:, javascript:, data:).
+// Surrounding whitespace is ignored. Query-only and fragment-only hrefs keep
+// base's path, and fragment-only and empty ones base's query too; fragments
+// are left in place for normalizeURL to strip, so "#top" dedups against the
+// page itself unless fragments are kept.
+func resolveURL(base *url.URL, href string) string {
+	u, err := url.Parse(protocolRelative(strings.TrimSpace(href)))
+	if err != nil {
+		return ""
+	}
+	resolved := base.ResolveReference(u)
+	if !isCrawlable(resolved) {
+		return ""
+	}
+	return resolved.String()
+}
+
+// protocolRelative rewrites the spellings of a protocol-relative href that
+// browsers accept, such as \\cdn.example.com/x or ///cdn.example.com/x, to
+// the plain //cdn.example.com/x form, which resolves to that host with base's
+// scheme. url.Parse would otherwise read them as paths on the current host.
+func protocolRelative(href string) string {
+	rest := strings.TrimLeft(href, "/\\")
+	if len(href)-len(rest) < 2 {
+		return href
+	}
+	return "//" + rest
+}
+
+// isCrawlable reports whether u uses a scheme the crawler can fetch.
+func isCrawlable(u *url.URL) bool {
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		return u.Host != ""
+	}
+	return false
+}
+
+
+
+
+
+
+
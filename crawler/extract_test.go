@@ -0,0 +1,321 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testFetchOptions parses text/html pages fetched with client.
+func testFetchOptions(client *http.Client) fetchOptions {
+	return fetchOptions{client: client, contentTypes: []string{"text/html"}}
+}
+
+// fetchFixture serves pages, keyed by path, from an httptest server and
+// extracts the links of the one at path.
+func fetchFixture(t *testing.T, pages map[string]string, path string) (*Page, *httptest.Server) {
+	t.Helper()
+	server := serveSite(t, pages)
+	page, err := extractLinks(t.Context(), server.URL+path, "", testFetchOptions(server.Client()))
+	if err != nil {
+		t.Fatalf("extractLinks(%s): %v", path, err)
+	}
+	return page, server
+}
+
+func TestIsCrawlable(t *testing.T) {
+	tests := []struct {
+		href string
+		want bool
+	}{
+		{"http://example.com/", true},
+		{"https://example.com/a", true},
+		{"HTTPS://example.com/a", true},
+		{"mailto:someone@example.com", false},
+		{"tel:+15555550123", false},
+		{"javascript:void(0)", false},
+		{"data:text/html,<p>hi</p>", false},
+		{"ftp://example.com/file", false},
+		{"http:///no-host", false},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.href)
+		if err != nil {
+			t.Fatalf("url.Parse(%q): %v", tt.href, err)
+		}
+		if got := isCrawlable(u); got != tt.want {
+			t.Errorf("isCrawlable(%q) = %v, want %v", tt.href, got, tt.want)
+		}
+	}
+}
+
+// Links with a scheme the crawler can't fetch are dropped when resolved,
+// so they never reach the queue.
+func TestResolveURLDropsUncrawlableSchemes(t *testing.T) {
+	base, _ := url.Parse("https://example.com/docs/page")
+	for _, href := range []string{
+		"mailto:someone@example.com",
+		"tel:+15555550123",
+		"javascript:void(0)",
+		"JavaScript:alert(1)",
+		"data:text/html,<p>hi</p>",
+	} {
+		if got := resolveURL(base, href); got != "" {
+			t.Errorf("resolveURL(%q) = %q, want \"\"", href, got)
+		}
+	}
+}
+
+func TestResolveURL(t *testing.T) {
+	base, _ := url.Parse("https://example.com/dir/page?x=1")
+	tests := []struct {
+		href string
+		want string
+	}{
+		{"other", "https://example.com/dir/other"},
+		{"./other", "https://example.com/dir/other"},
+		{"../up", "https://example.com/up"},
+		{"../../../up", "https://example.com/up"},
+		{"/a/./b/../c", "https://example.com/a/c"},
+		{"  /spaced  ", "https://example.com/spaced"},
+		{"?page=2", "https://example.com/dir/page?page=2"},
+		{"#top", "https://example.com/dir/page?x=1#top"},
+		{"", "https://example.com/dir/page?x=1"},
+		{"//cdn.example.com/x", "https://cdn.example.com/x"},
+		{"HTTPS://Example.COM/Up", "https://Example.COM/Up"},
+		{"http://other.example.com/p?b=2&a=1", "http://other.example.com/p?b=2&a=1"},
+		{"javascript:void(0)", ""},
+		{"mailto:someone@example.com", ""},
+		{"ftp://example.com/file", ""},
+		{"http:/x", ""},
+		{"https:", ""},
+		{"http://[::1", ""},
+		{"%zz", ""},
+		{"http://a b.com/", ""},
+	}
+	for _, tt := range tests {
+		if got := resolveURL(base, tt.href); got != tt.want {
+			t.Errorf("resolveURL(%q) = %q, want %q", tt.href, got, tt.want)
+		}
+	}
+}
+
+func TestExtractLinksBaseHref(t *testing.T) {
+	tests := []struct {
+		name string
+		base string
+		want []string
+	}{
+		{"relative path", "/v2/guide/", []string{"{server}/v2/guide/intro", "{server}/v2/api", "{server}/abs"}},
+		{"other host", "https://cdn.example.com/assets/", []string{"https://cdn.example.com/assets/intro", "https://cdn.example.com/api", "https://cdn.example.com/abs"}},
+		{"no base", "", []string{"{server}/docs/intro", "{server}/api", "{server}/abs"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			head := ""
+			if tt.base != "" {
+				head = `<head><base href="` + tt.base + `"></head>`
+			}
+			page, server := fetchFixture(t, map[string]string{
+				"/docs/page": "<html>" + head + `<body><a href="intro">i</a><a href="../api">a</a><a href="/abs">b</a></body></html>`,
+			}, "/docs/page")
+			want := make([]string, len(tt.want))
+			for i, u := range tt.want {
+				want[i] = strings.Replace(u, "{server}", server.URL, 1)
+			}
+			if !reflect.DeepEqual(page.Links, want) {
+				t.Errorf("links = %q, want %q", page.Links, want)
+			}
+		})
+	}
+}
+
+// A <base> after some links still applies to them, as it does in browsers.
+func TestExtractLinksBaseHrefAfterLinks(t *testing.T) {
+	page, server := fetchFixture(t, map[string]string{
+		"/docs/page": `<html><body><a href="early">e</a><base href="/v2/"><a href="late">l</a></body></html>`,
+	}, "/docs/page")
+	want := []string{server.URL + "/v2/early", server.URL + "/v2/late"}
+	if !reflect.DeepEqual(page.Links, want) {
+		t.Errorf("links = %q, want %q", page.Links, want)
+	}
+}
+
+func TestExtractLinks(t *testing.T) {
+	page, server := fetchFixture(t, map[string]string{
+		"/docs/page": `<html><head><title> Docs </title></head><body>
+			<a href="intro">relative</a>
+			<a href="../up">parent</a>
+			<a href="/abs">absolute path</a>
+			<a href="https://other.example.com/x">absolute</a>
+			<a href="//cdn.example.com/lib.js">protocol-relative</a>
+			<a href="mailto:someone@example.com">mail</a>
+			<a>no href</a>
+		</body></html>`,
+	}, "/docs/page")
+	want := []string{
+		server.URL + "/docs/intro",
+		server.URL + "/up",
+		server.URL + "/abs",
+		"https://other.example.com/x",
+		"http://cdn.example.com/lib.js",
+	}
+	if !reflect.DeepEqual(page.Links, want) {
+		t.Errorf("links = %q, want %q", page.Links, want)
+	}
+	if page.Status != http.StatusOK || page.FinalURL != server.URL+"/docs/page" || page.Title != "Docs" {
+		t.Errorf("page = status %d, final URL %q, title %q", page.Status, page.FinalURL, page.Title)
+	}
+}
+
+// Relative links resolve against the URL a redirect ended at, not the one
+// requested.
+func TestExtractLinksAfterRedirect(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/old/page", http.RedirectHandler("/new/dir/page", http.StatusMovedPermanently))
+	mux.HandleFunc("/new/dir/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, links("next", "/top"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	page, err := extractLinks(t.Context(), server.URL+"/old/page", "", testFetchOptions(server.Client()))
+	if err != nil {
+		t.Fatalf("extractLinks: %v", err)
+	}
+	if page.FinalURL != server.URL+"/new/dir/page" {
+		t.Errorf("FinalURL = %q, want %q", page.FinalURL, server.URL+"/new/dir/page")
+	}
+	want := []string{server.URL + "/new/dir/next", server.URL + "/top"}
+	if !reflect.DeepEqual(page.Links, want) {
+		t.Errorf("links = %q, want %q", page.Links, want)
+	}
+}
+
+func TestExtractLinksNotFound(t *testing.T) {
+	server := serveSite(t, map[string]string{"/": links("/a")})
+	page, err := extractLinks(t.Context(), server.URL+"/missing", "", testFetchOptions(server.Client()))
+	if err == nil || err.Error() != "status error: 404" {
+		t.Errorf("err = %v, want status error: 404", err)
+	}
+	if page == nil || page.Status != http.StatusNotFound || len(page.Links) != 0 {
+		t.Errorf("page = %+v, want status 404 and no links", page)
+	}
+}
+
+func TestExtractLinksRetryAfter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	_, err := extractLinks(t.Context(), server.URL+"/", "", testFetchOptions(server.Client()))
+	var retryErr *retryAfterError
+	if !errors.As(err, &retryErr) || retryErr.delay != 7*time.Second {
+		t.Errorf("err = %v, want a retryAfterError of 7s", err)
+	}
+}
+
+// A page slower than the fetch's deadline is abandoned with the deadline's
+// error rather than waited for.
+func TestExtractLinksTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := extractLinks(ctx, server.URL+"/", "", testFetchOptions(server.Client()))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("extractLinks returned after %v, want about 50ms", elapsed)
+	}
+}
+
+// Protocol-relative links, in every spelling browsers accept, go to their
+// own host with the scheme of the page they were found on.
+func TestResolveURLProtocolRelative(t *testing.T) {
+	for _, scheme := range []string{"http", "https"} {
+		base, _ := url.Parse(scheme + "://example.com/dir/page")
+		want := scheme + "://cdn.example.com/x"
+		for _, href := range []string{
+			"//cdn.example.com/x",
+			`\\cdn.example.com/x`,
+			`/\cdn.example.com/x`,
+			"///cdn.example.com/x",
+			" //cdn.example.com/x ",
+		} {
+			if got := resolveURL(base, href); got != want {
+				t.Errorf("resolveURL(%s page, %q) = %q, want %q", scheme, href, got, want)
+			}
+		}
+	}
+}
+
+// A protocol-relative link on an https page is queued as https.
+func TestExtractLinksProtocolRelativeOverHTTPS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, links("//cdn.example.com/x", `\\cdn.example.com/y`))
+	}))
+	defer server.Close()
+
+	page, err := extractLinks(t.Context(), server.URL+"/", "", testFetchOptions(server.Client()))
+	if err != nil {
+		t.Fatalf("extractLinks: %v", err)
+	}
+	want := []string{"https://cdn.example.com/x", "https://cdn.example.com/y"}
+	if !reflect.DeepEqual(page.Links, want) {
+		t.Errorf("links = %q, want %q", page.Links, want)
+	}
+}
+
+// Links come back in document order, however deeply they are nested, and
+// maxLinks keeps the first of them.
+func TestExtractLinksDocumentOrder(t *testing.T) {
+	server := serveSite(t, map[string]string{
+		"/": `<html><body>
+			<nav><a href="/z">z</a><ul><li><a href="/y">y</a></li><li><a href="/x">x</a></li></ul></nav>
+			<main><p>See <a href="/w">w</a> and <a href="/v">v</a>.</p></main>
+			<footer><a href="/u">u</a></footer>
+		</body></html>`,
+	})
+	var all []string
+	for _, path := range []string{"/z", "/y", "/x", "/w", "/v", "/u"} {
+		all = append(all, server.URL+path)
+	}
+
+	for _, maxLinks := range []int{0, 3} {
+		opts := testFetchOptions(server.Client())
+		opts.maxLinks = maxLinks
+		page, err := extractLinks(t.Context(), server.URL+"/", "", opts)
+		if err != nil {
+			t.Fatalf("extractLinks: %v", err)
+		}
+		want := all
+		if maxLinks > 0 {
+			want = all[:maxLinks]
+		}
+		if !reflect.DeepEqual(page.Links, want) {
+			t.Errorf("maxLinks %d: links = %q, want %q", maxLinks, page.Links, want)
+		}
+	}
+}
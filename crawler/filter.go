@@ -0,0 +1,239 @@
+package crawler
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// DomainFilter decides whether a resolved link stays inside the crawl's scope.
+// An empty filter (no seed host, no allowlist) accepts every host.
+type DomainFilter struct {
+	seedHosts map[string]bool
+	allowed   []string
+}
+
+// NewDomainFilter builds a filter from the seed URLs and the --allow-domains list.
+// When sameDomain is false the seed hosts are not implicitly allowed.
+func NewDomainFilter(seedURLs []string, sameDomain bool, allowDomains []string) *DomainFilter {
+	f := &DomainFilter{seedHosts: make(map[string]bool)}
+	if sameDomain {
+		for _, seedURL := range seedURLs {
+			if u, err := url.Parse(seedURL); err == nil {
+				f.seedHosts[strings.ToLower(u.Hostname())] = true
+			}
+		}
+	}
+	for _, d := range allowDomains {
+		d = strings.ToLower(strings.TrimSpace(d))
+		if d == "" {
+			continue
+		}
+		// Allow entries to be written with a port, e.g. "example.com:8080"
+		if host, _, err := net.SplitHostPort(d); err == nil {
+			d = host
+		}
+		f.allowed = append(f.allowed, d)
+	}
+	return f
+}
+
+// Allowed reports whether rawURL's host matches a seed host or an allowlist entry.
+// Matching is case-insensitive and ignores the port. An entry of the form
+// "*.example.com" matches example.com and any of its subdomains.
+func (f *DomainFilter) Allowed(rawURL string) bool {
+	if f == nil || (len(f.seedHosts) == 0 && len(f.allowed) == 0) {
+		return true
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return false
+	}
+	if f.seedHosts[host] {
+		return true
+	}
+	for _, pattern := range f.allowed {
+		if matchHost(pattern, host) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchHost(pattern, host string) bool {
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return host == suffix || strings.HasSuffix(host, "."+suffix)
+	}
+	return host == pattern
+}
+
+// PatternFilter applies the --include-pattern and --exclude-pattern regexps.
+type PatternFilter struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+// NewPatternFilter compiles the patterns, failing on the first invalid one.
+func NewPatternFilter(include, exclude []string) (*PatternFilter, error) {
+	f := &PatternFilter{}
+	for _, p := range include {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --include-pattern %q: %w", p, err)
+		}
+		f.include = append(f.include, re)
+	}
+	for _, p := range exclude {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --exclude-pattern %q: %w", p, err)
+		}
+		f.exclude = append(f.exclude, re)
+	}
+	return f, nil
+}
+
+// Allowed reports whether u should be followed. Any exclude match rejects u,
+// even if it also matches an include pattern. With no include patterns every
+// URL not excluded is allowed.
+func (f *PatternFilter) Allowed(u string) bool {
+	if f == nil {
+		return true
+	}
+	for _, re := range f.exclude {
+		if re.MatchString(u) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, re := range f.include {
+		if re.MatchString(u) {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultSkipExtensions are binary and media file types that rarely link
+// anywhere, so fetching them only wastes bandwidth.
+var DefaultSkipExtensions = []string{
+	"jpg", "jpeg", "png", "gif", "webp", "svg", "ico", "bmp", "tif", "tiff",
+	"mp3", "mp4", "m4a", "m4v", "avi", "mov", "mkv", "webm", "wav", "ogg", "flac",
+	"zip", "tar", "gz", "tgz", "bz2", "xz", "7z", "rar",
+	"exe", "dmg", "iso", "msi", "apk", "bin",
+	"pdf", "doc", "docx", "xls", "xlsx", "ppt", "pptx",
+	"css", "js", "woff", "woff2", "ttf", "otf", "eot",
+}
+
+// ExtensionFilter applies --skip-extensions and --only-extensions to the file
+// extension of a URL's path. Query strings and fragments are ignored, and
+// paths without an extension (such as "/" or "/about") always pass, since
+// they are usually pages that lead further.
+type ExtensionFilter struct {
+	skip map[string]bool
+	only map[string]bool
+}
+
+// NewExtensionFilter builds a filter from extensions with or without the
+// leading dot, matched case-insensitively. An empty only list allows every
+// extension that isn't skipped.
+func NewExtensionFilter(skip, only []string) *ExtensionFilter {
+	return &ExtensionFilter{skip: extensionSet(skip), only: extensionSet(only)}
+}
+
+func extensionSet(exts []string) map[string]bool {
+	set := make(map[string]bool, len(exts))
+	for _, ext := range exts {
+		ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), "."))
+		if ext != "" {
+			set[ext] = true
+		}
+	}
+	return set
+}
+
+// Allowed reports whether rawURL's extension may be fetched.
+func (f *ExtensionFilter) Allowed(rawURL string) bool {
+	if f == nil {
+		return true
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(u.Path), "."))
+	if ext == "" {
+		return true
+	}
+	if f.skip[ext] {
+		return false
+	}
+	return len(f.only) == 0 || f.only[ext]
+}
+
+// PrefixFilter applies --path-prefix, keeping the crawl inside one or more
+// subtrees of a site.
+type PrefixFilter struct {
+	prefixes []urlPrefix
+}
+
+// urlPrefix is a prefix split into the scheme and host it is limited to, if
+// any, and the path the URL's path must start with.
+type urlPrefix struct {
+	scheme string
+	host   string
+	path   string
+}
+
+// NewPrefixFilter parses each prefix as either a full URL such as
+// "https://docs.example.com/v2/", which also fixes the scheme and host, or a
+// path such as "/v2/", which applies on every host. With no prefixes every
+// URL is allowed.
+func NewPrefixFilter(prefixes []string) (*PrefixFilter, error) {
+	f := &PrefixFilter{}
+	for _, p := range prefixes {
+		u, err := url.Parse(strings.TrimSpace(p))
+		if err != nil || (u.Scheme == "") != (u.Host == "") || (u.Host == "" && !strings.HasPrefix(u.Path, "/")) {
+			return nil, fmt.Errorf("invalid --path-prefix %q: must be an absolute URL or start with /", p)
+		}
+		prefix := urlPrefix{scheme: strings.ToLower(u.Scheme), host: strings.ToLower(u.Host), path: u.Path}
+		if prefix.path == "" {
+			prefix.path = "/"
+		}
+		f.prefixes = append(f.prefixes, prefix)
+	}
+	return f, nil
+}
+
+// Allowed reports whether rawURL starts with any of the prefixes.
+func (f *PrefixFilter) Allowed(rawURL string) bool {
+	if f == nil || len(f.prefixes) == 0 {
+		return true
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	p := u.Path
+	if p == "" {
+		p = "/"
+	}
+	for _, prefix := range f.prefixes {
+		if prefix.host != "" && (prefix.scheme != strings.ToLower(u.Scheme) || prefix.host != strings.ToLower(u.Host)) {
+			continue
+		}
+		if strings.HasPrefix(p, prefix.path) {
+			return true
+		}
+	}
+	return false
+}
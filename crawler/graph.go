@@ -0,0 +1,127 @@
+package crawler
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// recordEdges stores every outbound link found on from as links:<id>:<from>.
+func (r *RedisClient) recordEdges(ctx context.Context, from string, to []string) error {
+	if len(to) == 0 {
+		return nil
+	}
+	members := make([]interface{}, len(to))
+	for i, link := range to {
+		members[i] = link
+	}
+	return r.client.SAdd(ctx, r.urlKey("links", from), members...).Err()
+}
+
+// exportGraph writes every recorded edge to path. Files ending in .graphml are
+// written as GraphML; anything else is a "source,target" CSV edge list.
+func exportGraph(ctx context.Context, r *RedisClient, path string) (int, error) {
+	prefix := r.urlKey("links", "")
+	edges := make(map[string][]string)
+	err := r.scan(ctx, prefix+"*", func(key string) error {
+		targets, err := r.client.SMembers(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		sort.Strings(targets)
+		edges[strings.TrimPrefix(key, prefix)] = targets
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	sources := make([]string, 0, len(edges))
+	for from := range edges {
+		sources = append(sources, from)
+	}
+	sort.Strings(sources)
+
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+
+	var count int
+	if strings.EqualFold(filepath.Ext(path), ".graphml") {
+		count, err = writeGraphML(w, sources, edges)
+	} else {
+		count, err = writeEdgeCSV(w, sources, edges)
+	}
+	if err != nil {
+		return count, err
+	}
+	if err := w.Flush(); err != nil {
+		return count, err
+	}
+	return count, f.Close()
+}
+
+func writeEdgeCSV(w *bufio.Writer, sources []string, edges map[string][]string) (int, error) {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"source", "target"}); err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, from := range sources {
+		for _, to := range edges[from] {
+			if err := cw.Write([]string{from, to}); err != nil {
+				return count, err
+			}
+			count++
+		}
+	}
+	cw.Flush()
+	return count, cw.Error()
+}
+
+func writeGraphML(w *bufio.Writer, sources []string, edges map[string][]string) (int, error) {
+	// Every URL that appears on either end of an edge becomes a node
+	nodes := make(map[string]bool)
+	for _, from := range sources {
+		nodes[from] = true
+		for _, to := range edges[from] {
+			nodes[to] = true
+		}
+	}
+	ids := make([]string, 0, len(nodes))
+	for u := range nodes {
+		ids = append(ids, u)
+	}
+	sort.Strings(ids)
+
+	fmt.Fprintln(w, xml.Header+`<graphml xmlns="http://graphml.graphdrawing.org/xmlns">`)
+	fmt.Fprintln(w, `  <graph id="crawl" edgedefault="directed">`)
+	for _, u := range ids {
+		fmt.Fprintf(w, "    <node id=\"%s\"/>\n", xmlEscape(u))
+	}
+	count := 0
+	for _, from := range sources {
+		for _, to := range edges[from] {
+			fmt.Fprintf(w, "    <edge source=\"%s\" target=\"%s\"/>\n", xmlEscape(from), xmlEscape(to))
+			count++
+		}
+	}
+	fmt.Fprintln(w, "  </graph>")
+	_, err := fmt.Fprintln(w, "</graphml>")
+	return count, err
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,51 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// readyTimeout bounds the Redis ping behind each /readyz request, so a hung
+// connection fails the probe instead of stalling it.
+const readyTimeout = 2 * time.Second
+
+// serveHealth serves liveness and readiness probes on addr from a background
+// goroutine until ctx is cancelled. /healthz always answers 200 while the
+// process is up; /readyz answers 200 only if Redis responds to a fresh ping, or always with
+// the memory backend.
+func serveHealth(ctx context.Context, addr string, redisClient *RedisClient) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if redisClient == nil {
+			// The memory backend has nothing to depend on
+			w.Write([]byte("ok\n"))
+			return
+		}
+		pingCtx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+		defer cancel()
+		if err := redisClient.Ping(pingCtx); err != nil {
+			http.Error(w, "redis: "+err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok\n"))
+	})
+
+	srv := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Health server stopped", "addr", addr, "error", err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), readyTimeout)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+}
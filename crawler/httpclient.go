@@ -0,0 +1,76 @@
+package crawler
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// newHTTPClient builds the client shared by every worker. Reusing one
+// Transport lets keep-alive connections to the same host be pooled instead of
+// opening a new connection per request. The cookie jar is shared the same way,
+// so a logged-in session applies to every worker. With insecureSkipVerify
+// certificates aren't verified, and resolve overrides DNS; see resolveDialer.
+func newHTTPClient(maxIdleConnsPerHost int, proxies []*url.URL, jar http.CookieJar, maxRedirects int, insecureSkipVerify bool, resolve map[string]string) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	transport := &http.Transport{
+		Proxy:                 proxyFunc(proxies),
+		DialContext:           resolveDialer(dialer, resolve),
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   maxIdleConnsPerHost,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	if insecureSkipVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	if transport.MaxIdleConns < maxIdleConnsPerHost {
+		transport.MaxIdleConns = maxIdleConnsPerHost
+	}
+	return &http.Client{Transport: transport, Jar: jar, CheckRedirect: checkRedirect(maxRedirects)}
+}
+
+// resolveDialer connects to the address resolve maps a "host:port" to,
+// like curl's --resolve, and dials every other address as usual. Only the
+// connection is redirected: requests keep their Host header and TLS server
+// name, so the site is crawled by name while a chosen IP serves it.
+func resolveDialer(dialer *net.Dialer, resolve map[string]string) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if len(resolve) == 0 {
+		return dialer.DialContext
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err == nil {
+			if ip, ok := resolve[net.JoinHostPort(strings.ToLower(host), port)]; ok {
+				addr = net.JoinHostPort(ip, port)
+			}
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}
+}
+
+// proxyFunc picks the proxy for each request. With no configured proxies the
+// standard HTTP_PROXY/HTTPS_PROXY/NO_PROXY environment variables apply; with
+// several, requests rotate through them round-robin.
+func proxyFunc(proxies []*url.URL) func(*http.Request) (*url.URL, error) {
+	switch len(proxies) {
+	case 0:
+		return http.ProxyFromEnvironment
+	case 1:
+		return http.ProxyURL(proxies[0])
+	}
+	var next atomic.Uint64
+	return func(*http.Request) (*url.URL, error) {
+		return proxies[(next.Add(1)-1)%uint64(len(proxies))], nil
+	}
+}
@@ -0,0 +1,95 @@
+package crawler
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// httpsHosts remembers which hosts have served a page over https, so
+// --prefer-https can upgrade the http:// links found to them. Hosts are
+// shared with other crawler processes through the https_hosts:<id> Redis
+// set; without Redis they are only kept in process. A nil httpsHosts
+// (PreferHTTPS off) upgrades nothing.
+type httpsHosts struct {
+	redisClient *RedisClient
+
+	mu    sync.Mutex
+	known map[string]bool
+}
+
+func newHTTPSHosts(redisClient *RedisClient) *httpsHosts {
+	return &httpsHosts{redisClient: redisClient, known: make(map[string]bool)}
+}
+
+// learn records the host of fetched, the URL a page was finally served from,
+// if it was served over https.
+func (h *httpsHosts) learn(ctx context.Context, logger *slog.Logger, fetched string) {
+	if h == nil {
+		return
+	}
+	u, err := url.Parse(fetched)
+	if err != nil || u.Scheme != "https" {
+		return
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Host, ":443"))
+	h.mu.Lock()
+	seen := h.known[host]
+	h.known[host] = true
+	h.mu.Unlock()
+	if seen {
+		return
+	}
+	logger.Debug("Host supports https, upgrading its http links", "host", host)
+	if h.redisClient != nil {
+		if err := h.redisClient.client.SAdd(ctx, h.redisClient.key("https_hosts"), host).Err(); err != nil {
+			logger.Warn("Redis error recording https host", "host", host, "error", err)
+		}
+	}
+}
+
+// upgrade rewrites an http:// link to https:// if its host is known to
+// support https, and returns every other link unchanged.
+func (h *httpsHosts) upgrade(ctx context.Context, link string) string {
+	if h == nil || !strings.HasPrefix(strings.ToLower(link), "http:") {
+		return link
+	}
+	u, err := url.Parse(link)
+	if err != nil || u.Scheme != "http" {
+		return link
+	}
+	// Port 80 is http's default, not the site's, so it's dropped with the
+	// scheme; any other port is kept and has to have served https itself
+	host := strings.ToLower(strings.TrimSuffix(u.Host, ":80"))
+	if !h.supports(ctx, host) {
+		return link
+	}
+	u.Scheme = "https"
+	u.Host = host
+	return u.String()
+}
+
+// supports reports whether host has served a page over https, asking Redis
+// when this process hasn't seen it do so.
+func (h *httpsHosts) supports(ctx context.Context, host string) bool {
+	h.mu.Lock()
+	known := h.known[host]
+	h.mu.Unlock()
+	if known || h.redisClient == nil {
+		return known
+	}
+	known, err := h.redisClient.client.SIsMember(ctx, h.redisClient.key("https_hosts"), host).Result()
+	if err != nil {
+		// Leave the link as found; the redirect dedup still catches the page
+		slog.Warn("Redis error checking https host", "host", host, "error", err)
+		return false
+	}
+	if known {
+		h.mu.Lock()
+		h.known[host] = true
+		h.mu.Unlock()
+	}
+	return known
+}
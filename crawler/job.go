@@ -0,0 +1,84 @@
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// JobVersion is the schema version encodeJob writes. Bump it when a change
+// to Job would be misread by workers that only know the current version;
+// adding an optional field doesn't need it.
+const JobVersion = 1
+
+// Job is the JSON payload of a WorkItem in the jobs:<id> queue, and the
+// format other tools push jobs in. Version may be left out, which reads as
+// version 1 (jobs queued before it existed had none). Depth may be left out
+// too, which reads as 0: the job is crawled like a seed, with the full depth
+// budget. It is a pointer so the crawler's own jobs always carry it.
+type Job struct {
+	Version      int    `json:"version,omitempty"`
+	URL          string `json:"url"`
+	Depth        *int   `json:"depth,omitempty"`
+	Attempt      int    `json:"attempt,omitempty"`
+	Deferrals    int    `json:"deferrals,omitempty"`
+	Parent       string `json:"parent,omitempty"`
+	TraceID      string `json:"trace_id,omitempty"`
+	ParentSpanID string `json:"parent_span_id,omitempty"`
+	// Error is why a job in the jobs_dead:<id> list was given up on
+	Error string `json:"error,omitempty"`
+}
+
+// newJob is item as a Job.
+func newJob(item WorkItem) Job {
+	return Job{
+		URL:          item.URL,
+		Depth:        &item.Depth,
+		Attempt:      item.Attempt,
+		Deferrals:    item.Deferrals,
+		Parent:       item.Parent,
+		TraceID:      item.TraceID,
+		ParentSpanID: item.ParentSpanID,
+	}
+}
+
+// encodeJob serializes job as the current JobVersion. Every job written to
+// Redis goes through it, so each carries the version it was written in.
+func encodeJob(job Job) (string, error) {
+	job.Version = JobVersion
+	data, err := json.Marshal(job)
+	return string(data), err
+}
+
+// decodeJob parses a queued job. Jobs may be pushed by tools other than the
+// crawler, so the JSON is checked rather than trusted: it must be of a known
+// version, have an absolute http(s) url, and a depth that isn't negative if
+// it has one. Anything else is an ErrMalformedJob. A job without a depth is
+// at depth 0.
+func decodeJob(data string) (WorkItem, error) {
+	var job Job
+	if err := json.Unmarshal([]byte(data), &job); err != nil {
+		return WorkItem{}, fmt.Errorf("%w %q: %v", ErrMalformedJob, data, err)
+	}
+	if job.Version < 0 || job.Version > JobVersion {
+		return WorkItem{}, fmt.Errorf("%w %q: unknown version %d", ErrMalformedJob, data, job.Version)
+	}
+	if u, err := url.Parse(job.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return WorkItem{}, fmt.Errorf("%w %q: url must be an absolute http or https URL", ErrMalformedJob, data)
+	}
+	item := WorkItem{
+		URL:          job.URL,
+		Attempt:      job.Attempt,
+		Deferrals:    job.Deferrals,
+		Parent:       job.Parent,
+		TraceID:      job.TraceID,
+		ParentSpanID: job.ParentSpanID,
+	}
+	if job.Depth != nil {
+		if *job.Depth < 0 {
+			return WorkItem{}, fmt.Errorf("%w %q: depth must not be negative", ErrMalformedJob, data)
+		}
+		item.Depth = *job.Depth
+	}
+	return item, nil
+}
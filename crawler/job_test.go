@@ -0,0 +1,88 @@
+package crawler
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestDecodeJob(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want WorkItem
+	}{
+		{"current version", `{"version":1,"url":"https://example.com/a","depth":2,"attempt":1,"parent":"https://example.com/"}`,
+			WorkItem{URL: "https://example.com/a", Depth: 2, Attempt: 1, Parent: "https://example.com/"}},
+		{"no version", `{"url":"https://example.com/a","depth":0}`, WorkItem{URL: "https://example.com/a"}},
+		{"missing depth", `{"url":"http://example.com/a"}`, WorkItem{URL: "http://example.com/a"}},
+		{"unknown fields", `{"url":"http://example.com/a","depth":1,"priority":"high"}`, WorkItem{URL: "http://example.com/a", Depth: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeJob(tt.data)
+			if err != nil {
+				t.Fatalf("decodeJob: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("decodeJob = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeJobMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"invalid JSON", `{"url":"https://example.com/a"`},
+		{"not an object", `"https://example.com/a"`},
+		{"missing url", `{"depth":1}`},
+		{"empty url", `{"url":"","depth":1}`},
+		{"relative url", `{"url":"/a","depth":1}`},
+		{"non-http url", `{"url":"ftp://example.com/a","depth":1}`},
+		{"url without host", `{"url":"https:///a","depth":1}`},
+		{"negative depth", `{"url":"https://example.com/a","depth":-1}`},
+		{"depth of the wrong type", `{"url":"https://example.com/a","depth":"1"}`},
+		{"negative version", `{"version":-1,"url":"https://example.com/a","depth":1}`},
+		{"unknown version", `{"version":` + strconv.Itoa(JobVersion+1) + `,"url":"https://example.com/a","depth":1}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item, err := decodeJob(tt.data)
+			if !errors.Is(err, ErrMalformedJob) {
+				t.Errorf("decodeJob = %+v, %v; want an ErrMalformedJob", item, err)
+			}
+		})
+	}
+}
+
+// A seed's depth of 0 survives the queue rather than reading as missing.
+func TestEncodeJobRoundTrip(t *testing.T) {
+	item := WorkItem{
+		URL:          "https://example.com/a",
+		Depth:        0,
+		Attempt:      2,
+		Deferrals:    1,
+		Parent:       "https://example.com/",
+		TraceID:      "4bf92f3577b34da6a3ce929d0e0e4736",
+		ParentSpanID: "00f067aa0ba902b7",
+	}
+	data, err := encodeJob(newJob(item))
+	if err != nil {
+		t.Fatalf("encodeJob: %v", err)
+	}
+	got, err := decodeJob(data)
+	if err != nil {
+		t.Fatalf("decodeJob(%s): %v", data, err)
+	}
+	if got != item {
+		t.Errorf("round trip = %+v, want %+v", got, item)
+	}
+	var job Job
+	if err := json.Unmarshal([]byte(data), &job); err != nil || job.Version != JobVersion {
+		t.Errorf("encodeJob = %s, want version %d", data, JobVersion)
+	}
+}
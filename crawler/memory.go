@@ -0,0 +1,367 @@
+package crawler
+
+import (
+	"container/heap"
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// memoryBackend keeps a job's queue, visited set and counters in process, for
+// crawls that run without Redis. Nothing survives the process, so it can't be
+// resumed or shared with other processes.
+type memoryBackend struct {
+	mu sync.Mutex
+	// jobs is a min-heap on score; queued holds the same items so an
+	// identical job isn't queued twice
+	jobs   memoryJobs
+	queued map[WorkItem]bool
+	seq    int
+	// deferred are jobs pushed to jobs once their due time has passed
+	deferred []memoryDeferredJob
+	// wake is signalled when a job is pushed, so a waiting Pop can take it
+	wake chan struct{}
+
+	visited      sync.Map
+	visitedCount atomic.Int64
+
+	// pending counts jobs pushed but not yet finished. idle is closed when
+	// it falls back to zero, which means the crawl is done: only a job being
+	// processed can push more.
+	pending int
+	idle    chan struct{}
+	done    bool
+
+	inflight  atomic.Int64
+	pages     int64
+	hostPages map[string]int64
+	statuses  map[string]int64
+	depths    map[string]int
+	soft404s  map[string]bool
+	tlsErrors map[string]bool
+	overflow  map[string]bool
+}
+
+func newMemoryBackend() *memoryBackend {
+	return &memoryBackend{
+		queued:    make(map[WorkItem]bool),
+		wake:      make(chan struct{}, 1),
+		idle:      make(chan struct{}),
+		hostPages: make(map[string]int64),
+		statuses:  make(map[string]int64),
+		depths:    make(map[string]int),
+		soft404s:  make(map[string]bool),
+		tlsErrors: make(map[string]bool),
+		overflow:  make(map[string]bool),
+	}
+}
+
+// memoryJob is a queued item, ordered by score and then by push order.
+type memoryJob struct {
+	item  WorkItem
+	score float64
+	seq   int
+}
+
+type memoryDeferredJob struct {
+	item  WorkItem
+	score float64
+	until time.Time
+}
+
+type memoryJobs []memoryJob
+
+func (h memoryJobs) Len() int { return len(h) }
+func (h memoryJobs) Less(i, j int) bool {
+	if h[i].score != h[j].score {
+		return h[i].score < h[j].score
+	}
+	return h[i].seq < h[j].seq
+}
+func (h memoryJobs) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *memoryJobs) Push(x interface{}) { *h = append(*h, x.(memoryJob)) }
+func (h *memoryJobs) Pop() interface{} {
+	old := *h
+	job := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return job
+}
+
+// Push queues item unless an identical job is already waiting.
+func (m *memoryBackend) Push(ctx context.Context, item WorkItem, score float64) (bool, error) {
+	m.mu.Lock()
+	if m.queued[item] {
+		m.mu.Unlock()
+		return false, nil
+	}
+	m.queued[item] = true
+	m.seq++
+	heap.Push(&m.jobs, memoryJob{item: item, score: score, seq: m.seq})
+	m.pending++
+	m.mu.Unlock()
+	m.signal()
+	return true, nil
+}
+
+// Defer holds item back until it is due. It counts as pending meanwhile, so
+// the crawl doesn't finish without it.
+func (m *memoryBackend) Defer(ctx context.Context, item WorkItem, score float64, until time.Time) error {
+	m.mu.Lock()
+	m.deferred = append(m.deferred, memoryDeferredJob{item: item, score: score, until: until})
+	m.pending++
+	m.mu.Unlock()
+	// A waiting Pop may have to wake up sooner for it
+	m.signal()
+	return nil
+}
+
+// promoteDeferred pushes the deferred jobs that are due at now, and returns
+// how long until the next one is, or 0 if none are left. m.mu must be held.
+func (m *memoryBackend) promoteDeferred(now time.Time) time.Duration {
+	var next time.Duration
+	kept := m.deferred[:0]
+	for _, job := range m.deferred {
+		if wait := job.until.Sub(now); wait > 0 {
+			kept = append(kept, job)
+			if next == 0 || wait < next {
+				next = wait
+			}
+			continue
+		}
+		if m.queued[job.item] {
+			// An identical job is already waiting, and still pending
+			m.pending--
+			continue
+		}
+		m.queued[job.item] = true
+		m.seq++
+		heap.Push(&m.jobs, memoryJob{item: job.item, score: job.score, seq: m.seq})
+	}
+	m.deferred = kept
+	return next
+}
+
+// Pop takes the lowest-scored job, waiting up to timeout for one to be pushed
+// or come due.
+func (m *memoryBackend) Pop(ctx context.Context, timeout time.Duration) (WorkItem, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		m.mu.Lock()
+		next := m.promoteDeferred(time.Now())
+		if m.jobs.Len() > 0 {
+			job := heap.Pop(&m.jobs).(memoryJob)
+			delete(m.queued, job.item)
+			more := m.jobs.Len() > 0
+			m.mu.Unlock()
+			if more {
+				// Pass the wake-up on to the next waiting worker
+				m.signal()
+			}
+			return job.item, nil
+		}
+		m.mu.Unlock()
+
+		var due <-chan time.Time
+		if next > 0 {
+			due = time.After(next)
+		}
+		select {
+		case <-m.wake:
+		case <-due:
+		case <-timer.C:
+			return WorkItem{}, ErrQueueEmpty
+		case <-ctx.Done():
+			return WorkItem{}, ctx.Err()
+		}
+	}
+}
+
+func (m *memoryBackend) signal() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (m *memoryBackend) QueueLen(ctx context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return int64(m.jobs.Len() + len(m.deferred)), nil
+}
+
+func (m *memoryBackend) CheckAndMark(ctx context.Context, u string) (bool, error) {
+	if _, loaded := m.visited.LoadOrStore(u, true); loaded {
+		return true, nil
+	}
+	m.visitedCount.Add(1)
+	return false, nil
+}
+
+func (m *memoryBackend) Unmark(ctx context.Context, u string) error {
+	if _, loaded := m.visited.LoadAndDelete(u); loaded {
+		m.visitedCount.Add(-1)
+	}
+	return nil
+}
+
+func (m *memoryBackend) VisitedCount(ctx context.Context) (int64, error) {
+	return m.visitedCount.Load(), nil
+}
+
+func (m *memoryBackend) StartJob(ctx context.Context) error {
+	m.inflight.Add(1)
+	return nil
+}
+
+// FinishJob marks a popped job done, closing idle once no job is left.
+func (m *memoryBackend) FinishJob(ctx context.Context) error {
+	m.inflight.Add(-1)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.pending--; m.pending == 0 && !m.done {
+		m.done = true
+		close(m.idle)
+	}
+	return nil
+}
+
+func (m *memoryBackend) InFlight(ctx context.Context) (int64, error) {
+	return m.inflight.Load(), nil
+}
+
+// wait blocks until every pushed job has finished or ctx is cancelled. Unlike
+// the Redis backend's polling, this is exact: no other process can add work.
+func (m *memoryBackend) wait(ctx context.Context) {
+	m.mu.Lock()
+	nothingQueued := m.pending == 0
+	m.mu.Unlock()
+	if nothingQueued {
+		return
+	}
+	select {
+	case <-m.idle:
+	case <-ctx.Done():
+	}
+}
+
+func (m *memoryBackend) ClaimPage(ctx context.Context, max int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.pages >= int64(max) {
+		return false, nil
+	}
+	m.pages++
+	return true, nil
+}
+
+func (m *memoryBackend) PagesClaimed(ctx context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.pages, nil
+}
+
+func (m *memoryBackend) ClaimHostPage(ctx context.Context, host string, max int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.hostPages[host] >= int64(max) {
+		return false, nil
+	}
+	m.hostPages[host]++
+	return true, nil
+}
+
+func (m *memoryBackend) HostPageCounts(ctx context.Context) (map[string]int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return copyCounts(m.hostPages), nil
+}
+
+func (m *memoryBackend) CountStatus(ctx context.Context, status string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.statuses[status]++
+	return nil
+}
+
+func (m *memoryBackend) StatusCounts(ctx context.Context) (map[string]int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return copyCounts(m.statuses), nil
+}
+
+func (m *memoryBackend) recordDepth(ctx context.Context, u string, depth int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.depths[u] = depth
+	return nil
+}
+
+func (m *memoryBackend) DepthCounts(ctx context.Context) (map[int]int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counts := make(map[int]int64)
+	for _, depth := range m.depths {
+		counts[depth]++
+	}
+	return counts, nil
+}
+
+func (m *memoryBackend) recordSoft404(ctx context.Context, u string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.soft404s[u] = true
+	return nil
+}
+
+func (m *memoryBackend) Soft404s(ctx context.Context) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	urls := make([]string, 0, len(m.soft404s))
+	for u := range m.soft404s {
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+	return urls, nil
+}
+
+func (m *memoryBackend) recordTLSError(ctx context.Context, u string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tlsErrors[u] = true
+	return nil
+}
+
+func (m *memoryBackend) TLSErrors(ctx context.Context) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	urls := make([]string, 0, len(m.tlsErrors))
+	for u := range m.tlsErrors {
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+	return urls, nil
+}
+
+func (m *memoryBackend) recordOverflow(ctx context.Context, u string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.overflow[u] = true
+	return nil
+}
+
+func (m *memoryBackend) OverflowCount(ctx context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return int64(len(m.overflow)), nil
+}
+
+func copyCounts(counts map[string]int64) map[string]int64 {
+	out := make(map[string]int64, len(counts))
+	for k, n := range counts {
+		out[k] = n
+	}
+	return out
+}
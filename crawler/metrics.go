@@ -0,0 +1,149 @@
+package crawler
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Crawl metrics. They are always updated; they are only exposed when
+// --metrics-addr is set and serveMetrics registers them.
+var (
+	pagesFetched = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "crawler_pages_fetched_total",
+		Help: "Pages fetched successfully.",
+	})
+	fetchErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "crawler_fetch_errors_total",
+		Help: "Failed fetches by HTTP status code, or \"network\" when no response was received.",
+	}, []string{"status"})
+	linksDiscovered = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "crawler_links_discovered_total",
+		Help: "Links extracted from fetched pages.",
+	})
+	dedupSkipped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "crawler_dedup_skipped_total",
+		Help: "Links not queued, or pages discarded, because the URL was already visited.",
+	})
+	queueOverflowed = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "crawler_queue_overflow_total",
+		Help: "New links dropped because the queue was at --max-queue-size.",
+	})
+	circuitOpened = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "crawler_circuit_opened_total",
+		Help: "Times a host's circuit breaker opened after --breaker-threshold failures in a row or a failed probe.",
+	})
+	circuitOpenJobs = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "crawler_circuit_open_jobs_total",
+		Help: "Jobs whose host's circuit was open when they were processed; they were deferred, or dropped with --breaker-mode drop.",
+	})
+	trapSkipped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "crawler_trap_skipped_total",
+		Help: "URLs skipped because their path template had reached --max-per-template.",
+	})
+	bodyTooLarge = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "crawler_body_too_large_total",
+		Help: "Pages not downloaded because their Content-Length was over --max-body-bytes.",
+	})
+	malformedJobs = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "crawler_malformed_jobs_total",
+		Help: "Jobs popped from the queue and dropped because their JSON had no usable url or depth.",
+	})
+	deadJobs = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "crawler_dead_jobs_total",
+		Help: "Jobs moved to the dead-letter list after using up --max-retries re-queues.",
+	})
+	redisErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "crawler_redis_errors_total",
+		Help: "Failed Redis operations by operation, including attempts that were retried.",
+	}, []string{"op"})
+	fetchLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "crawler_fetch_duration_seconds",
+		Help:    "Time spent fetching and parsing a page.",
+		Buckets: prometheus.DefBuckets,
+	})
+	workerJobs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "crawler_worker_jobs_total",
+		Help: "Jobs processed by each worker in this process.",
+	}, []string{"worker"})
+	workerErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "crawler_worker_fetch_errors_total",
+		Help: "Failed fetches by each worker in this process.",
+	}, []string{"worker"})
+)
+
+// observeFetchError counts a failed fetch under its status code.
+func observeFetchError(page *Page) {
+	fetchErrors.WithLabelValues(statusLabel(page)).Inc()
+}
+
+// statusLabel is page's HTTP status code, or "network" when no response was
+// received.
+func statusLabel(page *Page) string {
+	if page != nil && page.Status != 0 {
+		return strconv.Itoa(page.Status)
+	}
+	return "network"
+}
+
+// serveMetrics registers the crawl metrics plus queue depth, concurrency and
+// in-flight gauges and serves them on addr at /metrics from a background
+// goroutine.
+func serveMetrics(addr string, queue Queue, counters jobCounters, requests *requestLimiter) {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		pagesFetched,
+		fetchErrors,
+		linksDiscovered,
+		dedupSkipped,
+		queueOverflowed,
+		circuitOpened,
+		circuitOpenJobs,
+		trapSkipped,
+		bodyTooLarge,
+		malformedJobs,
+		deadJobs,
+		redisErrors,
+		fetchLatency,
+		workerJobs,
+		workerErrors,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "crawler_queue_depth",
+			Help: "Jobs waiting in the queue, deferred ones included.",
+		}, func() float64 {
+			n, err := queue.QueueLen(context.Background())
+			if err != nil {
+				return 0
+			}
+			return float64(n)
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "crawler_concurrency_limit",
+			Help: "Page fetches allowed in progress at once, which changes with --adaptive-concurrency.",
+		}, func() float64 {
+			return float64(requests.Limit())
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "crawler_inflight_jobs",
+			Help: "Jobs being processed by workers in every process sharing the job.",
+		}, func() float64 {
+			n, err := counters.InFlight(context.Background())
+			if err != nil {
+				return 0
+			}
+			return float64(n)
+		}),
+	)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			slog.Error("Metrics server stopped", "addr", addr, "error", err)
+		}
+	}()
+}
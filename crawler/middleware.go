@@ -0,0 +1,44 @@
+package crawler
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Fetcher sends one page request and returns its response.
+type Fetcher func(req *http.Request) (*http.Response, error)
+
+// RequestMiddleware wraps the fetch of every page. It may change req before
+// calling next, inspect or replace the response afterwards, or short-circuit
+// by returning without calling next at all. Returning ErrSkip drops the page
+// without counting it as a failed fetch.
+//
+//	c.Use(func(next crawler.Fetcher) crawler.Fetcher {
+//		return func(req *http.Request) (*http.Response, error) {
+//			req.Header.Set("Authorization", "Bearer "+token)
+//			return next(req)
+//		}
+//	})
+type RequestMiddleware func(next Fetcher) Fetcher
+
+// ErrSkip is returned by a RequestMiddleware to veto a page. Its links are
+// not followed and it is not reported as a fetch error.
+var ErrSkip = errors.New("skipped by middleware")
+
+// Use registers middleware around every page request. Middlewares run in the
+// order they were registered, so the first one sees the request first and the
+// response last. Use must be called before Start; robots.txt, sitemap and
+// login requests don't go through middleware.
+func (c *Crawler) Use(mw RequestMiddleware) {
+	c.middleware = append(c.middleware, mw)
+}
+
+// chain builds the Fetcher that runs every registered middleware around the
+// HTTP client.
+func (c *Crawler) chain() Fetcher {
+	fetch := Fetcher(c.fetchOpts.client.Do)
+	for i := len(c.middleware) - 1; i >= 0; i-- {
+		fetch = c.middleware[i](fetch)
+	}
+	return fetch
+}
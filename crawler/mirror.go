@@ -0,0 +1,104 @@
+package crawler
+
+import (
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// maxMirrorName caps each file or directory name in a mirror, leaving room
+// under the usual 255-byte limit for the hash suffix added to long names.
+const maxMirrorName = 200
+
+// MirrorStore saves fetched page bodies under a directory tree that follows
+// the site's URLs, like wget -m: https://example.com/blog/post is written to
+// <dir>/example.com/blog/post.html.
+type MirrorStore struct {
+	dir string
+}
+
+func NewMirrorStore(dir string) (*MirrorStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &MirrorStore{dir: dir}, nil
+}
+
+// Put writes data to the mirror path key, creating its directories.
+func (s *MirrorStore) Put(key string, data []byte) error {
+	target := filepath.Join(s.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(target, data, 0o644)
+}
+
+func (s *MirrorStore) Close() error {
+	return nil
+}
+
+// keyFor maps u to its relative path in the mirror. Paths ending in "/" get
+// index.html, names without a .html or .htm extension get one appended, and a
+// query string is folded into the file name after an "@", so
+// /search?q=go becomes search@q=go.html. Characters that aren't safe in file
+// names are replaced with "_".
+func (s *MirrorStore) keyFor(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.Host == "" {
+		return "_invalid/" + urlHash(u) + ".html"
+	}
+
+	segments := []string{mirrorName(strings.ToLower(parsed.Host), u)}
+	dirs, file := path.Split(parsed.EscapedPath())
+	for _, dir := range strings.Split(dirs, "/") {
+		if dir != "" {
+			segments = append(segments, mirrorName(unescapePath(dir), u))
+		}
+	}
+
+	file = unescapePath(file)
+	if file == "" {
+		file = "index"
+	}
+	ext := strings.ToLower(path.Ext(file))
+	if parsed.RawQuery != "" {
+		file += "@" + parsed.RawQuery
+		ext = ""
+	}
+	if ext != ".html" && ext != ".htm" {
+		file += ".html"
+	}
+	segments = append(segments, mirrorName(file, u))
+	return strings.Join(segments, "/")
+}
+
+// mirrorName makes name safe to use as one file or directory name, shortening
+// it with a hash of the page URL u if it is too long.
+func mirrorName(name, u string) string {
+	safe := strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if safe == "." || safe == ".." {
+		safe = "_"
+	}
+	if len(safe) > maxMirrorName {
+		ext := path.Ext(safe)
+		if len(ext) > 10 {
+			ext = ""
+		}
+		safe = strings.ToValidUTF8(safe[:maxMirrorName-len(ext)-17], "") + "-" + urlHash(u)[:16] + ext
+	}
+	return safe
+}
+
+func unescapePath(segment string) string {
+	if unescaped, err := url.PathUnescape(segment); err == nil {
+		return unescaped
+	}
+	return segment
+}
@@ -0,0 +1,61 @@
+package crawler
+
+import (
+	"net/url"
+	"strings"
+)
+
+// URLNormalizer rewrites URLs into a canonical form so trivially different
+// spellings of the same page share one entry in the visited set.
+type URLNormalizer struct {
+	keepFragments      bool
+	keepQuery          bool
+	stripTrailingSlash bool
+}
+
+// normalizeURL lowercases the scheme and host, drops default ports, strips the
+// fragment, sorts query parameters, and optionally trims a trailing slash.
+// URLs that fail to parse are returned unchanged.
+func (n *URLNormalizer) normalizeURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return raw
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]" // IPv6 literal
+	}
+	if port != "" {
+		host += ":" + port
+	}
+	u.Host = host
+
+	if !n.keepFragments {
+		u.Fragment = ""
+		u.RawFragment = ""
+	}
+
+	if !n.keepQuery && u.RawQuery != "" {
+		// Encode sorts by key, so ?c=2&b=1 and ?b=1&c=2 collapse together
+		u.RawQuery = u.Query().Encode()
+	}
+
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	if n.stripTrailingSlash && len(u.Path) > 1 && strings.HasSuffix(u.Path, "/") {
+		u.Path = strings.TrimRight(u.Path, "/")
+		if u.Path == "" {
+			u.Path = "/"
+		}
+		u.RawPath = ""
+	}
+
+	return u.String()
+}
@@ -0,0 +1,77 @@
+package crawler
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// reportProgress logs the job's progress every interval from a background
+// goroutine: pages fetched, of which errors, queue depth, jobs in flight and
+// the fetch rate since the previous report. Counts cover every process
+// working on the job. The returned function stops the reporter and waits for
+// it to exit.
+func (c *Crawler) reportProgress(ctx context.Context, interval time.Duration) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	var done sync.WaitGroup
+	done.Add(1)
+	go func() {
+		defer done.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		var lastPages int64
+		last := time.Now()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				pages, errs, err := c.fetchCounts(ctx)
+				if err != nil {
+					slog.Warn("Error counting pages for progress", "error", err)
+					continue
+				}
+				queued, _ := c.queue.QueueLen(ctx)
+				inflight, _ := c.counters.InFlight(ctx)
+				rate := float64(pages-lastPages) / now.Sub(last).Seconds()
+				slog.Info("Progress",
+					"pages", pages,
+					"errors", errs,
+					"queued", queued,
+					"in_flight", inflight,
+					"pages_per_sec", strconv.FormatFloat(rate, 'f', 1, 64),
+				)
+				lastPages, last = pages, now
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		done.Wait()
+	}
+}
+
+// fetchCounts totals the job's status counts into pages fetched and, of
+// those, errors: 4xx and 5xx responses and fetches that got no response.
+func (c *Crawler) fetchCounts(ctx context.Context) (pages, errs int64, err error) {
+	statuses, err := c.counters.StatusCounts(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	pages, errs = countFetches(statuses)
+	return pages, errs, nil
+}
+
+// countFetches totals status counts into fetches and errors.
+func countFetches(statuses map[string]int64) (pages, errs int64) {
+	for status, n := range statuses {
+		pages += n
+		if code, err := strconv.Atoi(status); err != nil || code >= 400 {
+			errs += n
+		}
+	}
+	return pages, errs
+}
@@ -0,0 +1,78 @@
+package crawler
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"time"
+)
+
+// Backoff bounds while waiting for room in a full queue.
+const (
+	queueWaitMin = 100 * time.Millisecond
+	queueWaitMax = 5 * time.Second
+)
+
+// roomInQueue returns how many more of a page's links may be queued under
+// MaxQueueSize; once they are, or when it returns 0, links go to
+// dropOverflow. While the queue holds MaxQueueSize jobs or more, the "drop"
+// policy returns 0 straight away. "block" waits, backing off, for the queue to
+// drain below the limit, and only gives up once every busy worker in this
+// process is waiting too, since nothing here would drain the queue then. A
+// Redis error, or ctx being cancelled while waiting, lets the next link
+// through.
+func (c *Crawler) roomInQueue(ctx context.Context, logger *slog.Logger) int64 {
+	if c.maxQueueSize <= 0 {
+		return math.MaxInt64
+	}
+	n, err := c.queue.QueueLen(ctx)
+	if err != nil {
+		return 1
+	}
+	if n < c.maxQueueSize {
+		return c.maxQueueSize - n
+	}
+	if !c.queueFull.Swap(true) {
+		logger.Info("Reached --max-queue-size, applying --queue-overflow", "queued", n, "max_queue_size", c.maxQueueSize, "queue_overflow", c.queueOverflow)
+	}
+	if c.queueOverflow == "drop" {
+		return 0
+	}
+
+	c.waiting.Add(1)
+	defer c.waiting.Add(-1)
+	for delay := queueWaitMin; ; delay = min(delay*2, queueWaitMax) {
+		if c.waiting.Load() >= c.busy.Load() {
+			logger.Debug("Queue full and every worker waiting, dropping links", "queued", n)
+			return 0
+		}
+		select {
+		case <-ctx.Done():
+			return 1
+		case <-time.After(delay):
+		}
+		n, err = c.queue.QueueLen(ctx)
+		if err != nil {
+			return 1
+		}
+		if n < c.maxQueueSize {
+			return c.maxQueueSize - n
+		}
+	}
+}
+
+// dropOverflow handles a link found while the queue is full: it is marked
+// visited without being queued and, unless it had been visited already,
+// recorded in overflow:<id>. It returns why the link wasn't queued.
+func (c *Crawler) dropOverflow(ctx context.Context, link string) string {
+	link = c.normalizer.normalizeURL(link)
+	if visited, err := c.visited.CheckAndMark(ctx, link); err == nil && visited {
+		dedupSkipped.Inc()
+		return "visited"
+	}
+	if err := c.counters.recordOverflow(ctx, link); err != nil {
+		slog.Warn("Redis error recording queue overflow", "url", link, "error", err)
+	}
+	queueOverflowed.Inc()
+	return "queue full"
+}
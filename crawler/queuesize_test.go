@@ -0,0 +1,68 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+// A page with more new links than the queue has room for queues only as
+// many as fit, and drops the rest.
+func TestQueueOverflowDropCapsPage(t *testing.T) {
+	pages := map[string]string{}
+	var hrefs []string
+	for i := range 10 {
+		path := fmt.Sprintf("/p%d", i)
+		hrefs = append(hrefs, path)
+		pages[path] = links()
+	}
+	pages["/"] = links(hrefs...)
+	site := serveSite(t, pages)
+
+	cfg := memoryConfig(site.URL + "/")
+	cfg.StreamResults = false
+	cfg.Workers = 1
+	cfg.MaxQueueSize = 3
+	cfg.QueueOverflow = "drop"
+	c, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	result, err := c.Start(ctx)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if result.QueueOverflow != 7 || result.Succeeded != 4 {
+		t.Errorf("QueueOverflow = %d, Succeeded = %d; want 7 and 4", result.QueueOverflow, result.Succeeded)
+	}
+}
+
+// A worker blocked on a full queue stops waiting when it is stopped.
+func TestRoomInQueueBlockCancelled(t *testing.T) {
+	cfg := memoryConfig("http://example.com/")
+	cfg.MaxQueueSize = 1
+	cfg.QueueOverflow = "block"
+	c, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer c.Close()
+	if _, err := c.queue.Push(context.Background(), WorkItem{URL: "http://example.com/a"}, 0); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+	// Another worker is busy, so this one keeps waiting for it
+	c.busy.Store(2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	c.roomInQueue(ctx, slog.Default())
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("roomInQueue returned %v after being cancelled, want at once", elapsed)
+	}
+}
@@ -0,0 +1,174 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// reserveSlot atomically books the next fetch slot for a host. It returns how
+// many milliseconds the caller must wait before its slot begins.
+var reserveSlot = redis.NewScript(`
+local last = tonumber(redis.call("GET", KEYS[1]) or "0")
+local now = tonumber(ARGV[1])
+local delay = tonumber(ARGV[2])
+local nextSlot = math.max(now, last + delay)
+redis.call("SET", KEYS[1], nextSlot, "PX", math.max(nextSlot - now + delay, 1))
+return nextSlot - now
+`)
+
+// pushBack moves a host's next fetch slot to at least now+ARGV[2] milliseconds.
+var pushBack = redis.NewScript(`
+local last = tonumber(redis.call("GET", KEYS[1]) or "0")
+local until_ = tonumber(ARGV[1]) + tonumber(ARGV[2])
+if until_ > last then
+	redis.call("SET", KEYS[1], until_, "PX", tonumber(ARGV[2]) + 1000)
+end
+return 0
+`)
+
+// defaultRetryAfter is used when a 429/503 response carries no usable Retry-After.
+const defaultRetryAfter = 30 * time.Second
+
+// maxRetryAfter caps how long a single Retry-After may stall a host.
+const maxRetryAfter = 10 * time.Minute
+
+// retryAfterError reports a 429 or 503 response the server asked us to retry later.
+type retryAfterError struct {
+	status int
+	delay  time.Duration
+}
+
+func (e *retryAfterError) Error() string {
+	return fmt.Sprintf("status error: %d (retry after %v)", e.status, e.delay)
+}
+
+// parseRetryAfter accepts either delay-seconds or an HTTP-date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	delay := defaultRetryAfter
+	if secs, err := strconv.Atoi(value); err == nil && secs >= 0 {
+		delay = time.Duration(secs) * time.Second
+	} else if t, err := http.ParseTime(value); err == nil {
+		delay = t.Sub(now)
+		if delay < 0 {
+			delay = 0
+		}
+	}
+	if delay > maxRetryAfter {
+		delay = maxRetryAfter
+	}
+	return delay
+}
+
+// HostLimiter enforces a minimum interval between requests to the same host.
+// Slots are reserved in Redis (last_fetch:<host>) so the limit holds across
+// every worker and every crawler process sharing the queue. With a nil
+// redisClient (the memory backend) only the local slots are used.
+type HostLimiter struct {
+	redisClient *RedisClient
+	delay       time.Duration
+
+	// local is used when Redis is unreachable or absent so we still stay polite
+	mu    sync.Mutex
+	local map[string]time.Time
+}
+
+func NewHostLimiter(redisClient *RedisClient, delay time.Duration) *HostLimiter {
+	return &HostLimiter{
+		redisClient: redisClient,
+		delay:       delay,
+		local:       make(map[string]time.Time),
+	}
+}
+
+// Wait blocks until rawURL's host may be fetched again, or returns ctx's
+// error if it is cancelled first. minDelay (e.g. a robots.txt Crawl-delay)
+// raises the interval above the configured --delay. Hosts that were backed
+// off after a 429/503 are waited on even without a delay.
+func (l *HostLimiter) Wait(ctx context.Context, rawURL string, minDelay time.Duration) error {
+	delay := l.delay
+	if minDelay > delay {
+		delay = minDelay
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil
+	}
+	host := strings.ToLower(u.Host)
+
+	var wait time.Duration
+	if l.redisClient == nil {
+		wait = l.reserveLocal(host, delay)
+	} else if wait, err = l.reserve(ctx, host, delay); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		slog.Warn("Redis error reserving fetch slot", "host", host, "error", err)
+		wait = l.reserveLocal(host, delay)
+	}
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Backoff stops every worker from fetching rawURL's host for at least d.
+func (l *HostLimiter) Backoff(ctx context.Context, rawURL string, d time.Duration) {
+	u, err := url.Parse(rawURL)
+	if err != nil || d <= 0 {
+		return
+	}
+	host := strings.ToLower(u.Host)
+
+	now := time.Now()
+	if l.redisClient != nil {
+		if err := pushBack.Run(ctx, l.redisClient.client, []string{"last_fetch:" + host}, now.UnixMilli(), d.Milliseconds()).Err(); err != nil {
+			slog.Warn("Redis error backing off host", "host", host, "error", err)
+		}
+	}
+
+	l.mu.Lock()
+	if until := now.Add(d); until.After(l.local[host]) {
+		l.local[host] = until
+	}
+	l.mu.Unlock()
+}
+
+func (l *HostLimiter) reserve(ctx context.Context, host string, delay time.Duration) (time.Duration, error) {
+	now := time.Now().UnixMilli()
+	ms, err := reserveSlot.Run(ctx, l.redisClient.client, []string{"last_fetch:" + host}, now, delay.Milliseconds()).Int64()
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+func (l *HostLimiter) reserveLocal(host string, delay time.Duration) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	next := l.local[host].Add(delay)
+	if next.Before(now) {
+		next = now
+	}
+	l.local[host] = next
+	return next.Sub(now)
+}
@@ -0,0 +1,90 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// A worker waiting out a long delay must be released as soon as its
+// context is cancelled.
+func TestHostLimiterWaitCancelled(t *testing.T) {
+	l := NewHostLimiter(nil, time.Hour)
+	const u = "http://example.com/a"
+	if err := l.Wait(context.Background(), u, 0); err != nil {
+		t.Fatalf("first Wait: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	err := l.Wait(ctx, u, 0)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wait = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if waited := time.Since(started); waited > time.Second {
+		t.Errorf("Wait returned after %v, want about 50ms", waited)
+	}
+}
+
+// A robots.txt Crawl-delay longer than --delay is honored too.
+func TestHostLimiterWaitMinDelay(t *testing.T) {
+	l := NewHostLimiter(nil, 0)
+	const u = "http://example.com/a"
+	if err := l.Wait(context.Background(), u, 100*time.Millisecond); err != nil {
+		t.Fatalf("first Wait: %v", err)
+	}
+	started := time.Now()
+	if err := l.Wait(context.Background(), u, 100*time.Millisecond); err != nil {
+		t.Fatalf("second Wait: %v", err)
+	}
+	if waited := time.Since(started); waited < 50*time.Millisecond {
+		t.Errorf("second Wait returned after %v, want about 100ms", waited)
+	}
+}
+
+// A 429 defers its job until Retry-After has passed instead of holding a
+// worker, which goes on to crawl other hosts in the meantime.
+func TestRateLimitedJobDeferred(t *testing.T) {
+	other := serveSite(t, map[string]string{
+		"/":     links("/next"),
+		"/next": links(),
+	})
+	var limited atomic.Bool
+	var site *httptest.Server
+	site = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(links("/busy", other.URL+"/")))
+		case "/busy":
+			if !limited.Swap(true) {
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.Write([]byte(links()))
+		}
+	}))
+	defer site.Close()
+
+	cfg := memoryConfig(site.URL + "/")
+	cfg.Workers = 1
+	var order []string
+	var busy PageResult
+	for _, result := range crawl(t, cfg) {
+		order = append(order, result.URL)
+		if result.URL == site.URL+"/busy" {
+			busy = result
+		}
+	}
+	if busy.Attempt != 1 || busy.Status != http.StatusOK {
+		t.Errorf("last fetch of /busy = attempt %d, status %d; want attempt 1 with 200", busy.Attempt, busy.Status)
+	}
+	if n := len(order); n == 0 || order[n-1] != site.URL+"/busy" {
+		t.Errorf("crawled %v, want /busy last, after the other host", order)
+	}
+}
@@ -0,0 +1,91 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// redirectLoopError reports a chain of HTTP or meta-refresh redirects that led
+// back to a URL already visited along the way.
+type redirectLoopError struct {
+	chain []string
+}
+
+func (e *redirectLoopError) Error() string {
+	return "redirect loop: " + strings.Join(e.chain, " -> ")
+}
+
+// checkRedirect stops the client on a redirect back to any URL earlier in the
+// chain, and after maxRedirects hops.
+func checkRedirect(maxRedirects int) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		target := req.URL.String()
+		for i, prev := range via {
+			if prev.URL.String() == target {
+				chain := make([]string, 0, len(via)-i+1)
+				for _, r := range via[i:] {
+					chain = append(chain, r.URL.String())
+				}
+				return &redirectLoopError{chain: append(chain, target)}
+			}
+		}
+		if len(via) >= maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		return nil
+	}
+}
+
+// fetchFollowingRefresh fetches target and, while the page declares a
+// <meta http-equiv="refresh"> to another URL, fetches that instead, up to
+// opts.maxRedirects hops. The last page is returned. referer is sent with the
+// first request; each hop is sent with the page that refreshed to it.
+func fetchFollowingRefresh(ctx context.Context, target, referer string, opts fetchOptions) (*Page, error) {
+	chain := []string{target}
+	for hops := 0; ; hops++ {
+		page, err := extractLinks(ctx, target, referer, opts)
+		if err != nil || page.Refresh == "" || hops >= opts.maxRedirects {
+			return page, err
+		}
+		// A refresh to the page itself just reloads it
+		if page.Refresh == target || page.Refresh == page.FinalURL {
+			return page, nil
+		}
+		if page.FinalURL != "" && page.FinalURL != target {
+			chain = append(chain, page.FinalURL)
+		}
+		for _, prev := range chain {
+			if prev == page.Refresh {
+				return page, &redirectLoopError{chain: append(chain, page.Refresh)}
+			}
+		}
+		referer = target
+		if page.FinalURL != "" {
+			referer = page.FinalURL
+		}
+		target = page.Refresh
+		chain = append(chain, target)
+		opts.validators = nil
+	}
+}
+
+// parseRefresh returns the URL of a meta refresh content value such as
+// "0; url=/next", or "" when it only reloads the page.
+func parseRefresh(content string) string {
+	_, rest, ok := strings.Cut(content, ";")
+	if !ok {
+		_, rest, ok = strings.Cut(content, ",")
+	}
+	if !ok {
+		return ""
+	}
+	rest = strings.TrimSpace(rest)
+	if len(rest) >= 4 && strings.EqualFold(rest[:3], "url") {
+		if after := strings.TrimSpace(rest[3:]); strings.HasPrefix(after, "=") {
+			rest = strings.TrimSpace(after[1:])
+		}
+	}
+	return strings.Trim(rest, `"'`)
+}
@@ -0,0 +1,538 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type RedisClient struct {
+	// client is a plain, Sentinel failover, or Cluster client; everything
+	// below uses only the shared UniversalClient interface
+	client redis.UniversalClient
+	// jobID namespaces every per-crawl key so concurrent crawls don't collide
+	jobID string
+	// process tells this process's jobs in flight apart from those of other
+	// processes working on the job; see holdLease
+	process string
+	// revisitAfter, when set, keeps last-crawl times in the visited_at:<id>
+	// sorted set instead of the visited:<id> set, so URLs expire and are
+	// crawled again
+	revisitAfter time.Duration
+	// bloom, when set, marks URLs in a RedisBloom filter instead of the
+	// visited:<id> set
+	bloom *bloomFilter
+}
+
+
+// NewRedisClient connects in the given mode ("single", "sentinel" or
+// "cluster") and pings the server, so a bad address or password is reported
+// here rather than on the first queue operation. A server that can't be
+// reached yet, such as one starting alongside the crawler, is pinged again
+// with backoff until connectTimeout has passed; 0 pings only once.
+func NewRedisClient(mode string, opts *redis.UniversalOptions, jobID string, connectTimeout time.Duration) (*RedisClient, error) {
+	var client redis.UniversalClient
+	switch mode {
+	case "", "single":
+		client = redis.NewClient(opts.Simple())
+	case "sentinel":
+		client = redis.NewFailoverClient(opts.Failover())
+	case "cluster":
+		client = redis.NewClusterClient(opts.Cluster())
+	default:
+		return nil, fmt.Errorf("unknown Redis mode %q: use single, sentinel, or cluster", mode)
+	}
+
+	pong, err := pingUntil(client, connectTimeout)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("could not connect to Redis at %s (db %d): %w", strings.Join(opts.Addrs, ","), opts.DB, err)
+	}
+	slog.Debug("Connected to Redis", "mode", mode, "addrs", opts.Addrs, "db", opts.DB, "reply", pong)
+	return &RedisClient{client: client, jobID: jobID, process: randomHex(8)}, nil
+}
+
+// redisConnectBackoffMax caps the wait between startup pings.
+const redisConnectBackoffMax = 5 * time.Second
+
+// pingUntil pings client until it answers or timeout has passed, waiting
+// redisRetryBackoff after the first failure and doubling up to
+// redisConnectBackoffMax. A reply other than LOADING, such as a rejected
+// password, won't change by waiting, so it is returned straight away.
+func pingUntil(client redis.UniversalClient, timeout time.Duration) (string, error) {
+	deadline := time.Now().Add(timeout)
+	backoff := redisRetryBackoff
+	for attempt := 1; ; attempt++ {
+		pong, err := client.Ping(context.Background()).Result()
+		if err == nil {
+			return pong, nil
+		}
+		var reply redis.Error
+		if errors.As(err, &reply) && !strings.HasPrefix(err.Error(), "LOADING") {
+			return "", err
+		}
+		wait := min(backoff, time.Until(deadline))
+		if wait <= 0 {
+			return "", err
+		}
+		slog.Debug("Redis not reachable yet, retrying", "attempt", attempt, "retry_in", wait, "error", err)
+		time.Sleep(wait)
+		backoff = min(backoff*2, redisConnectBackoffMax)
+	}
+}
+
+// redisAttempts is how many times a queue or visited-set operation is tried
+// before its error is returned. Waits between tries start at
+// redisRetryBackoff and double.
+const (
+	redisAttempts     = 3
+	redisRetryBackoff = 100 * time.Millisecond
+)
+
+// retry runs fn until it succeeds, returns redis.Nil, or has failed
+// redisAttempts times, counting every failure under op.
+func retry(ctx context.Context, op string, fn func() error) error {
+	var err error
+	for attempt := 0; attempt < redisAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(redisRetryBackoff << (attempt - 1)):
+			case <-ctx.Done():
+				return err
+			}
+		}
+		err = fn()
+		if err == nil || err == redis.Nil {
+			return err
+		}
+		redisErrors.WithLabelValues(op).Inc()
+	}
+	return err
+}
+
+// Ping checks that Redis is still reachable.
+func (r *RedisClient) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
+func (r *RedisClient) CloseConnection() {	
+	r.client.Close()
+}
+
+// key namespaces a per-crawl Redis key by job id, e.g. "jobs" -> "jobs:<id>".
+func (r *RedisClient) key(name string) string {
+	return name + ":" + r.jobID
+}
+
+// urlKey builds a per-URL key within the job, e.g. "page:<id>:<url>".
+func (r *RedisClient) urlKey(name, u string) string {
+	return r.key(name) + ":" + u
+}
+
+// Reset deletes every key belonging to this crawl job: the queue, the visited
+// set, and all per-URL data. Keys are deleted one at a time since in a Cluster
+// they may live in different hash slots.
+func (r *RedisClient) Reset(ctx context.Context) (int64, error) {
+	var deleted int64
+	for _, name := range []string{"jobs", "job_seq", "jobs_deferred", "jobs_dead", "visited", "visited_at", "visited_bloom", "unvisited", "url_depth", "content_types", "pages_fetched", "host_pages", "redirect_loops", "status_counts", "broken", "broken_attempts", "soft404", "tls_errors", "overflow", "https_hosts", "templates", "content_hashes", "content_dupes", "hashes_seen", "change_counts", "process_inflight", "process_leases"} {
+		n, err := r.client.Del(ctx, r.key(name)).Result()
+		if err != nil {
+			return deleted, err
+		}
+		deleted += n
+	}
+	for _, name := range []string{"page", "links", "headers", "validators", "extract", "breaker"} {
+		err := r.scan(ctx, r.urlKey(name, "*"), func(key string) error {
+			n, err := r.client.Del(ctx, key).Result()
+			deleted += n
+			return err
+		})
+		if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+// scan calls fn for every key matching pattern. A Cluster is scanned one
+// master at a time, since SCAN only covers the node it is sent to.
+func (r *RedisClient) scan(ctx context.Context, pattern string, fn func(key string) error) error {
+	scanNode := func(ctx context.Context, node redis.UniversalClient) error {
+		iter := node.Scan(ctx, 0, pattern, 1000).Iterator()
+		for iter.Next(ctx) {
+			if err := fn(iter.Val()); err != nil {
+				return err
+			}
+		}
+		return iter.Err()
+	}
+	if cluster, ok := r.client.(*redis.ClusterClient); ok {
+		var mu sync.Mutex
+		return cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			// ForEachMaster runs nodes concurrently; fn isn't expected to be safe for that
+			mu.Lock()
+			defer mu.Unlock()
+			return scanNode(ctx, node)
+		})
+	}
+	return scanNode(ctx, r.client)
+}
+
+// VisitedCount returns how many URLs this job has marked visited.
+func (r *RedisClient) VisitedCount(ctx context.Context) (int64, error) {
+	if r.revisitAfter > 0 {
+		return r.client.ZCard(ctx, r.key("visited_at")).Result()
+	}
+	if r.bloom != nil {
+		return r.bloomVisitedCount(ctx)
+	}
+	return r.client.SCard(ctx, r.key("visited")).Result()
+}
+
+// recordDepth remembers the depth u was first discovered at.
+func (r *RedisClient) recordDepth(ctx context.Context, u string, depth int) error {
+	return r.client.HSet(ctx, r.key("url_depth"), u, depth).Err()
+}
+
+// DepthCounts returns how many URLs were first discovered at each depth.
+func (r *RedisClient) DepthCounts(ctx context.Context) (map[int]int64, error) {
+	depths, err := r.client.HVals(ctx, r.key("url_depth")).Result()
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[int]int64)
+	for _, d := range depths {
+		depth, err := strconv.Atoi(d)
+		if err != nil {
+			continue
+		}
+		counts[depth]++
+	}
+	return counts, nil
+}
+
+// claimPage increments the job's fetched-page counter unless it has already
+// reached ARGV[1], returning 1 if the caller may fetch.
+var claimPage = redis.NewScript(`
+local n = tonumber(redis.call("GET", KEYS[1]) or "0")
+if n >= tonumber(ARGV[1]) then
+	return 0
+end
+redis.call("INCR", KEYS[1])
+return 1
+`)
+
+// ClaimPage reserves one of the job's max page fetches. It returns false once
+// max pages have been claimed by any worker in any process.
+func (r *RedisClient) ClaimPage(ctx context.Context, max int) (bool, error) {
+	var ok int
+	err := retry(ctx, "claim_page", func() (err error) {
+		ok, err = claimPage.Run(ctx, r.client, []string{r.key("pages_fetched")}, max).Int()
+		return err
+	})
+	return ok == 1, err
+}
+
+// PagesClaimed returns how many page fetches the job has claimed.
+func (r *RedisClient) PagesClaimed(ctx context.Context) (int64, error) {
+	n, err := r.client.Get(ctx, r.key("pages_fetched")).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return n, err
+}
+
+// claimHostPage is claimPage for one field of a hash, so every host's count
+// lives in a single host_pages:<id> key.
+var claimHostPage = redis.NewScript(`
+local n = tonumber(redis.call("HGET", KEYS[1], ARGV[1]) or "0")
+if n >= tonumber(ARGV[2]) then
+	return 0
+end
+redis.call("HINCRBY", KEYS[1], ARGV[1], 1)
+return 1
+`)
+
+// ClaimHostPage reserves one of host's max page fetches for this job. It
+// returns false once host has used its whole budget.
+func (r *RedisClient) ClaimHostPage(ctx context.Context, host string, max int) (bool, error) {
+	var ok int
+	err := retry(ctx, "claim_host_page", func() (err error) {
+		ok, err = claimHostPage.Run(ctx, r.client, []string{r.key("host_pages")}, host, max).Int()
+		return err
+	})
+	return ok == 1, err
+}
+
+// HostPageCounts returns how many page fetches each host has claimed.
+func (r *RedisClient) HostPageCounts(ctx context.Context) (map[string]int64, error) {
+	fields, err := r.client.HGetAll(ctx, r.key("host_pages")).Result()
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64, len(fields))
+	for host, n := range fields {
+		counts[host], _ = strconv.ParseInt(n, 10, 64)
+	}
+	return counts, nil
+}
+
+// CountStatus tallies one fetch outcome in the job's status_counts hash.
+func (r *RedisClient) CountStatus(ctx context.Context, status string) error {
+	return r.client.HIncrBy(ctx, r.key("status_counts"), status, 1).Err()
+}
+
+// StatusCounts returns how many fetches ended with each status code, plus
+// "network" for fetches that got no response.
+func (r *RedisClient) StatusCounts(ctx context.Context) (map[string]int64, error) {
+	fields, err := r.client.HGetAll(ctx, r.key("status_counts")).Result()
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64, len(fields))
+	for status, n := range fields {
+		counts[status], _ = strconv.ParseInt(n, 10, 64)
+	}
+	return counts, nil
+}
+
+// recordSoft404 adds u to the job's soft404 set.
+func (r *RedisClient) recordSoft404(ctx context.Context, u string) error {
+	return r.client.SAdd(ctx, r.key("soft404"), u).Err()
+}
+
+// Soft404s returns the URLs recorded as soft 404s, sorted.
+func (r *RedisClient) Soft404s(ctx context.Context) ([]string, error) {
+	urls, err := r.client.SMembers(ctx, r.key("soft404")).Result()
+	sort.Strings(urls)
+	return urls, err
+}
+
+// recordTLSError adds u to the job's tls_errors set.
+func (r *RedisClient) recordTLSError(ctx context.Context, u string) error {
+	return r.client.SAdd(ctx, r.key("tls_errors"), u).Err()
+}
+
+// TLSErrors returns the URLs whose fetch failed on a TLS error, sorted.
+func (r *RedisClient) TLSErrors(ctx context.Context) ([]string, error) {
+	urls, err := r.client.SMembers(ctx, r.key("tls_errors")).Result()
+	sort.Strings(urls)
+	return urls, err
+}
+
+// recordOverflow adds u to the job's overflow set of links dropped because
+// the queue was full.
+func (r *RedisClient) recordOverflow(ctx context.Context, u string) error {
+	return r.client.SAdd(ctx, r.key("overflow"), u).Err()
+}
+
+// OverflowCount returns how many links were dropped because the queue was
+// full.
+func (r *RedisClient) OverflowCount(ctx context.Context) (int64, error) {
+	return r.client.SCard(ctx, r.key("overflow")).Result()
+}
+
+// recordHeaders stores the named response headers of u in headers:<id>:<u>,
+// skipping any the response didn't have.
+func (r *RedisClient) recordHeaders(ctx context.Context, u string, header http.Header, names []string) error {
+	fields := make(map[string]interface{}, len(names))
+	for _, name := range names {
+		if values := header.Values(name); len(values) > 0 {
+			fields[http.CanonicalHeaderKey(name)] = strings.Join(values, ", ")
+		}
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return r.client.HSet(ctx, r.urlKey("headers", u), fields).Err()
+}
+
+// recordExtracted stores the fields extracted from u in extract:<id>:<u>.
+func (r *RedisClient) recordExtracted(ctx context.Context, u string, fields map[string]string) error {
+	values := make(map[string]interface{}, len(fields))
+	for name, text := range fields {
+		values[name] = text
+	}
+	return r.client.HSet(ctx, r.urlKey("extract", u), values).Err()
+}
+
+// jobSeqSpan spaces queue scores apart so the job_seq:<id> counter can order
+// jobs with the same score by push order, up to this many pushes per job.
+const jobSeqSpan = 1 << 32
+
+// Push adds item to the job's jobs:<id> sorted set as a JSON Job. The stored
+// score is score scaled by jobSeqSpan plus the next job_seq:<id> value, so
+// jobs with equal scores pop in the order they were pushed, in every process,
+// rather than in the sorted set's lexical order. It returns false if an identical
+// job was already queued, which keeps its place.
+func (r *RedisClient) Push(ctx context.Context, item WorkItem, score float64) (bool, error) {
+	job, err := encodeJob(newJob(item))
+	if err != nil {
+		return false, err
+	}
+	var added int64
+	err = retry(ctx, "push_job", func() error {
+		seq, err := r.client.Incr(ctx, r.key("job_seq")).Result()
+		if err != nil {
+			return err
+		}
+		added, err = r.client.ZAddNX(ctx, r.key("jobs"), &redis.Z{Score: score*jobSeqSpan + float64(seq%jobSeqSpan), Member: job}).Result()
+		return err
+	})
+	return added == 1, err
+}
+
+// deferredJob is a member of the jobs_deferred:<id> sorted set, which is
+// scored by when the job is due: the JSON Job and the score it is pushed with.
+type deferredJob struct {
+	Score float64         `json:"score"`
+	Job   json.RawMessage `json:"job"`
+}
+
+// promoteBatch caps how many due deferred jobs one Pop pushes.
+const promoteBatch = 100
+
+// Defer adds item to the jobs_deferred:<id> sorted set until it is due.
+func (r *RedisClient) Defer(ctx context.Context, item WorkItem, score float64, until time.Time) error {
+	job, err := encodeJob(newJob(item))
+	if err != nil {
+		return err
+	}
+	member, err := json.Marshal(deferredJob{Score: score, Job: json.RawMessage(job)})
+	if err != nil {
+		return err
+	}
+	return retry(ctx, "defer_job", func() error {
+		return r.client.ZAdd(ctx, r.key("jobs_deferred"), &redis.Z{Score: float64(until.UnixMilli()), Member: string(member)}).Err()
+	})
+}
+
+// promoteDeferred pushes the deferred jobs that are due. Every process's
+// workers promote, and only the one whose ZREM removes a job pushes it.
+func (r *RedisClient) promoteDeferred(ctx context.Context) error {
+	due, err := r.client.ZRangeByScore(ctx, r.key("jobs_deferred"), &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(time.Now().UnixMilli(), 10),
+		Count: promoteBatch,
+	}).Result()
+	if err != nil {
+		return err
+	}
+	for _, member := range due {
+		removed, err := r.client.ZRem(ctx, r.key("jobs_deferred"), member).Result()
+		if err != nil {
+			return err
+		}
+		if removed == 0 {
+			continue
+		}
+		var deferred deferredJob
+		if err := json.Unmarshal([]byte(member), &deferred); err != nil {
+			slog.Warn("Dropped malformed deferred job", "job", member, "error", err)
+			continue
+		}
+		item, err := decodeJob(string(deferred.Job))
+		if err != nil {
+			slog.Warn("Dropped malformed deferred job", "error", err)
+			continue
+		}
+		if _, err := r.Push(ctx, item, deferred.Score); err != nil {
+			// Put it back, due straight away, rather than lose it
+			if err := r.client.ZAdd(ctx, r.key("jobs_deferred"), &redis.Z{Score: 0, Member: member}).Err(); err != nil {
+				slog.Error("Redis error putting back deferred job", "job", member, "error", err)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Pop blocks for up to timeout waiting for the lowest-scored job, after
+// pushing any deferred jobs that are due. It returns ErrQueueEmpty if the
+// queue stayed empty, and ErrMalformedJob, from decodeJob, if the job
+// couldn't be used.
+func (r *RedisClient) Pop(ctx context.Context, timeout time.Duration) (WorkItem, error) {
+	var item WorkItem
+	if err := r.promoteDeferred(ctx); err != nil {
+		return item, err
+	}
+	z, err := r.client.BZPopMin(ctx, timeout, r.key("jobs")).Result()
+	if err == redis.Nil {
+		return item, ErrQueueEmpty
+	}
+	if err != nil {
+		return item, err
+	}
+	job, _ := z.Member.(string)
+	return decodeJob(job)
+}
+
+// QueueLen returns the number of jobs waiting in the queue or deferred.
+func (r *RedisClient) QueueLen(ctx context.Context) (int64, error) {
+	queued, err := r.client.ZCard(ctx, r.key("jobs")).Result()
+	if err != nil {
+		return 0, err
+	}
+	deferred, err := r.client.ZCard(ctx, r.key("jobs_deferred")).Result()
+	return queued + deferred, err
+}
+
+// markVisitedAt records u as crawled now unless it was already crawled within
+// the last ARGV[3] milliseconds, returning 1 if it was added.
+var markVisitedAt = redis.NewScript(`
+local last = redis.call("ZSCORE", KEYS[1], ARGV[1])
+if last and tonumber(ARGV[2]) - tonumber(last) < tonumber(ARGV[3]) then
+	return 0
+end
+redis.call("ZADD", KEYS[1], ARGV[2], ARGV[1])
+return 1
+`)
+
+// CheckAndMark atomically checks and marks u in the job's visited set. It
+// returns true if u had already been seen, or with revisitAfter set, seen
+// recently. Failures are retried; a persistent one is returned rather than
+// guessing either way.
+func (r *RedisClient) CheckAndMark(ctx context.Context, u string) (bool, error) {
+	if r.bloom != nil {
+		var visited bool
+		err := retry(ctx, "mark_visited", func() (err error) {
+			visited, err = r.bloomCheckAndMark(ctx, u)
+			return err
+		})
+		return visited, err
+	}
+	var added int64
+	err := retry(ctx, "mark_visited", func() (err error) {
+		if r.revisitAfter > 0 {
+			added, err = markVisitedAt.Run(ctx, r.client, []string{r.key("visited_at")}, u, time.Now().UnixMilli(), r.revisitAfter.Milliseconds()).Int64()
+			return err
+		}
+		added, err = r.client.SAdd(ctx, r.key("visited"), u).Result()
+		return err
+	})
+	// added == 1 means u was new, so not visited
+	return added == 0, err
+}
+
+// Unmark removes u from the visited set so it can be crawled again.
+func (r *RedisClient) Unmark(ctx context.Context, u string) error {
+	return retry(ctx, "unmark_visited", func() error {
+		if r.revisitAfter > 0 {
+			return r.client.ZRem(ctx, r.key("visited_at"), u).Err()
+		}
+		if r.bloom != nil {
+			return r.bloomUnmark(ctx, u)
+		}
+		return r.client.SRem(ctx, r.key("visited"), u).Err()
+	})
+}
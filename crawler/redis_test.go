@@ -0,0 +1,105 @@
+package crawler
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// newTestRedis returns a RedisClient for job "test" on a fresh miniredis
+// server, and the server.
+func newTestRedis(t *testing.T) (*RedisClient, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client, err := NewRedisClient("single", &redis.UniversalOptions{Addrs: []string{server.Addr()}}, "test", 0)
+	if err != nil {
+		t.Fatalf("NewRedisClient: %v", err)
+	}
+	t.Cleanup(client.CloseConnection)
+	return client, server
+}
+
+func TestCheckAndMark(t *testing.T) {
+	r, server := newTestRedis(t)
+	ctx := context.Background()
+	const u = "http://example.com/a"
+
+	visited, err := r.CheckAndMark(ctx, u)
+	if err != nil || visited {
+		t.Fatalf("first CheckAndMark = %v, %v; want false, nil", visited, err)
+	}
+	visited, err = r.CheckAndMark(ctx, u)
+	if err != nil || !visited {
+		t.Fatalf("second CheckAndMark = %v, %v; want true, nil", visited, err)
+	}
+	if ok, _ := server.SIsMember("visited:test", u); !ok {
+		t.Errorf("%s not in visited:test", u)
+	}
+	if n, err := r.VisitedCount(ctx); err != nil || n != 1 {
+		t.Errorf("VisitedCount = %d, %v; want 1, nil", n, err)
+	}
+
+	if err := r.Unmark(ctx, u); err != nil {
+		t.Fatalf("Unmark: %v", err)
+	}
+	if visited, err := r.CheckAndMark(ctx, u); err != nil || visited {
+		t.Errorf("CheckAndMark after Unmark = %v, %v; want false, nil", visited, err)
+	}
+}
+
+// Workers racing to mark the same URL must agree that exactly one of them
+// saw it first.
+func TestCheckAndMarkConcurrent(t *testing.T) {
+	r, _ := newTestRedis(t)
+	ctx := context.Background()
+
+	const markers = 50
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	first := 0
+	for range markers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			visited, err := r.CheckAndMark(ctx, "http://example.com/")
+			if err != nil {
+				t.Errorf("CheckAndMark: %v", err)
+				return
+			}
+			if !visited {
+				mu.Lock()
+				first++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if first != 1 {
+		t.Errorf("%d of %d concurrent CheckAndMark calls saw the URL as new, want 1", first, markers)
+	}
+}
+
+func TestCheckAndMarkRevisitAfter(t *testing.T) {
+	r, _ := newTestRedis(t)
+	r.revisitAfter = 50 * time.Millisecond
+	ctx := context.Background()
+	const u = "http://example.com/a"
+
+	if visited, err := r.CheckAndMark(ctx, u); err != nil || visited {
+		t.Fatalf("first CheckAndMark = %v, %v; want false, nil", visited, err)
+	}
+	if visited, err := r.CheckAndMark(ctx, u); err != nil || !visited {
+		t.Fatalf("CheckAndMark within revisitAfter = %v, %v; want true, nil", visited, err)
+	}
+	time.Sleep(2 * r.revisitAfter)
+	if visited, err := r.CheckAndMark(ctx, u); err != nil || visited {
+		t.Errorf("CheckAndMark after revisitAfter = %v, %v; want false, nil", visited, err)
+	}
+	if n, err := r.VisitedCount(ctx); err != nil || n != 1 {
+		t.Errorf("VisitedCount = %d, %v; want 1, nil", n, err)
+	}
+}
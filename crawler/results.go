@@ -0,0 +1,202 @@
+package crawler
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// PageResult is one record of the --output file, and what Results streams.
+type PageResult struct {
+	URL           string `json:"url"`
+	Depth         int    `json:"depth"`
+	Parent        string `json:"parent,omitempty"`
+	Status        int    `json:"status,omitempty"`
+	ContentLength int    `json:"content_length"`
+	Links         int    `json:"links"`
+	Error         string `json:"error,omitempty"`
+	TraceID       string `json:"trace_id,omitempty"`
+	SpanID        string `json:"span_id,omitempty"`
+	// Extracted holds the text matched by each Config.Extract selector
+	Extracted map[string]string `json:"extracted,omitempty"`
+	// Change is how the page compares with the previous run when
+	// Config.DetectChanges is set: "new", "changed", "unchanged", or
+	// "removed" for a page crawled last run and not this one
+	Change string `json:"change,omitempty"`
+	// Attempt is how many times the job had been re-queued before this fetch
+	Attempt int `json:"attempt,omitempty"`
+}
+
+// resultColumns is the header row of the CSV format, in PageResult order.
+var resultColumns = []string{"url", "depth", "parent", "status", "content_length", "links", "error", "trace_id", "span_id", "extracted", "change", "attempt"}
+
+// csvRecord flattens result into a row under resultColumns. Extracted fields
+// are kept together as a JSON object in the last column.
+func (result PageResult) csvRecord() ([]string, error) {
+	extracted := ""
+	if len(result.Extracted) > 0 {
+		data, err := json.Marshal(result.Extracted)
+		if err != nil {
+			return nil, err
+		}
+		extracted = string(data)
+	}
+	status := ""
+	if result.Status != 0 {
+		status = strconv.Itoa(result.Status)
+	}
+	return []string{
+		result.URL, strconv.Itoa(result.Depth), result.Parent, status,
+		strconv.Itoa(result.ContentLength), strconv.Itoa(result.Links),
+		result.Error, result.TraceID, result.SpanID, extracted, result.Change,
+		strconv.Itoa(result.Attempt),
+	}, nil
+}
+
+// resultSummary is written as the final line of ndjson output when the writer
+// is closed.
+type resultSummary struct {
+	Summary bool `json:"summary"`
+	Pages   int  `json:"pages"`
+	Errors  int  `json:"errors"`
+	Links   int  `json:"links"`
+	Bytes   int  `json:"bytes"`
+}
+
+// ResultWriter writes PageResults to a file as "ndjson" (one JSON object per
+// line, appended), "json" (a single array, rewritten each run) or "csv"
+// (appended, with a header row when the file is new). Workers write
+// concurrently, so every write goes through the mutex-guarded buffered
+// writer.
+type ResultWriter struct {
+	mu     sync.Mutex
+	file   *os.File
+	w      *bufio.Writer
+	format string
+	enc    *json.Encoder
+	csv    *csv.Writer
+	// written counts the records written, so the JSON array knows when to
+	// open and where to put commas
+	written int
+	summary resultSummary
+}
+
+// NewResultWriter opens path for results in format: "ndjson", "json" or
+// "csv"; "" means ndjson.
+func NewResultWriter(path, format string) (*ResultWriter, error) {
+	if format == "" {
+		format = "ndjson"
+	}
+	flags := os.O_CREATE | os.O_APPEND | os.O_WRONLY
+	switch format {
+	case "ndjson", "csv":
+	case "json":
+		// An array can't be appended to, so each run starts the file over
+		flags = os.O_CREATE | os.O_TRUNC | os.O_WRONLY
+	default:
+		return nil, fmt.Errorf("unknown output format %q", format)
+	}
+	file, err := os.OpenFile(path, flags, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("opening output file: %w", err)
+	}
+	w := bufio.NewWriter(file)
+	r := &ResultWriter{
+		file:    file,
+		w:       w,
+		format:  format,
+		enc:     json.NewEncoder(w),
+		summary: resultSummary{Summary: true},
+	}
+	if format == "csv" {
+		r.csv = csv.NewWriter(w)
+		// The header is only written once, not again on every appended run
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("opening output file: %w", err)
+		}
+		if info.Size() == 0 {
+			if err := r.csv.Write(resultColumns); err != nil {
+				file.Close()
+				return nil, err
+			}
+		}
+	}
+	return r, nil
+}
+
+func (r *ResultWriter) Write(result PageResult) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Removed pages weren't fetched by this run, so they aren't summarized
+	if result.Change != changeRemoved {
+		r.summary.Pages++
+		if result.Error != "" {
+			r.summary.Errors++
+		}
+		r.summary.Links += result.Links
+		r.summary.Bytes += result.ContentLength
+	}
+
+	switch r.format {
+	case "csv":
+		record, err := result.csvRecord()
+		if err != nil {
+			return err
+		}
+		return r.csv.Write(record)
+	case "json":
+		data, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		sep := ",\n  "
+		if r.written == 0 {
+			sep = "[\n  "
+		}
+		r.written++
+		if _, err := r.w.WriteString(sep); err != nil {
+			return err
+		}
+		_, err = r.w.Write(data)
+		return err
+	}
+	return r.enc.Encode(result)
+}
+
+// Close finishes the output, with the summary line for ndjson or the closing
+// bracket for json, flushes buffered results, and closes the file.
+func (r *ResultWriter) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var err error
+	switch r.format {
+	case "ndjson":
+		err = r.enc.Encode(r.summary)
+	case "json":
+		end := "\n]\n"
+		if r.written == 0 {
+			end = "[]\n"
+		}
+		_, err = r.w.WriteString(end)
+	case "csv":
+		r.csv.Flush()
+		err = r.csv.Error()
+	}
+	if err != nil {
+		r.file.Close()
+		return err
+	}
+	if err := r.w.Flush(); err != nil {
+		r.file.Close()
+		return err
+	}
+	return r.file.Close()
+}
@@ -0,0 +1,295 @@
+package crawler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// robotsTTL is how long parsed robots.txt rules stay cached in Redis.
+const robotsTTL = 24 * time.Hour
+
+// robotsRules is the subset of a robots.txt file that applies to our user
+// agent, plus the file's Sitemap lines, which apply to every agent.
+type robotsRules struct {
+	Allow      []string      `json:"allow,omitempty"`
+	Disallow   []string      `json:"disallow,omitempty"`
+	CrawlDelay time.Duration `json:"crawl_delay,omitempty"`
+	Sitemaps   []string      `json:"sitemaps,omitempty"`
+}
+
+// RobotsCache fetches /robots.txt once per scheme+host and caches the parsed
+// rules in Redis so every worker (and every crawler process) shares them.
+// Without Redis they are only cached in process.
+type RobotsCache struct {
+	redisClient *RedisClient
+	httpClient  *http.Client
+	userAgent   string
+	// timeout bounds each robots.txt fetch, like a page fetch
+	timeout time.Duration
+
+	mu    sync.Mutex
+	local map[string]*robotsRules
+}
+
+func NewRobotsCache(redisClient *RedisClient, httpClient *http.Client, userAgent string, timeout time.Duration) *RobotsCache {
+	return &RobotsCache{
+		redisClient: redisClient,
+		httpClient:  httpClient,
+		userAgent:   userAgent,
+		timeout:     timeout,
+		local:       make(map[string]*robotsRules),
+	}
+}
+
+// Allowed reports whether rawURL may be fetched and returns the host's Crawl-delay.
+// A nil cache (--ignore-robots) allows everything.
+func (r *RobotsCache) Allowed(ctx context.Context, rawURL string) (bool, time.Duration) {
+	if r == nil {
+		return true, 0
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false, 0
+	}
+	rules := r.rulesFor(ctx, u)
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	return rules.allows(path), rules.CrawlDelay
+}
+
+// Sitemaps returns the sitemap URLs listed in the robots.txt of rawURL's host,
+// resolved against it. A nil cache (--ignore-robots) returns none.
+func (r *RobotsCache) Sitemaps(ctx context.Context, rawURL string) []string {
+	if r == nil {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil
+	}
+	base := &url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/robots.txt"}
+	var sitemaps []string
+	for _, loc := range r.rulesFor(ctx, u).Sitemaps {
+		if ref, err := url.Parse(loc); err == nil {
+			sitemaps = append(sitemaps, base.ResolveReference(ref).String())
+		}
+	}
+	return sitemaps
+}
+
+func (r *RobotsCache) rulesFor(ctx context.Context, u *url.URL) *robotsRules {
+	key := u.Scheme + "://" + u.Host
+
+	r.mu.Lock()
+	rules, ok := r.local[key]
+	r.mu.Unlock()
+	if ok {
+		return rules
+	}
+
+	if r.redisClient == nil {
+		rules = r.fetch(ctx, key+"/robots.txt")
+		if ctx.Err() == nil {
+			r.store(key, rules)
+		}
+		return rules
+	}
+	redisKey := "robots:" + key
+	if cached, err := r.redisClient.client.Get(ctx, redisKey).Result(); err == nil {
+		rules = &robotsRules{}
+		if err := json.Unmarshal([]byte(cached), rules); err == nil {
+			r.store(key, rules)
+			return rules
+		}
+	}
+
+	rules = r.fetch(ctx, key+"/robots.txt")
+	if ctx.Err() != nil {
+		// The fetch was cut short, so the empty rules mustn't be cached
+		return rules
+	}
+	if data, err := json.Marshal(rules); err == nil {
+		if err := r.redisClient.client.Set(ctx, redisKey, data, robotsTTL).Err(); err != nil {
+			slog.Warn("Redis error caching robots.txt", "host", key, "error", err)
+		}
+	}
+	r.store(key, rules)
+	return rules
+}
+
+func (r *RobotsCache) store(key string, rules *robotsRules) {
+	r.mu.Lock()
+	r.local[key] = rules
+	r.mu.Unlock()
+}
+
+// fetch downloads and parses a robots.txt file. Any failure to retrieve it is
+// treated as "no restrictions", matching common crawler behavior.
+func (r *RobotsCache) fetch(ctx context.Context, robotsURL string) *robotsRules {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", robotsURL, nil)
+	if err != nil {
+		return &robotsRules{}
+	}
+	req.Header.Set("User-Agent", r.userAgent)
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return &robotsRules{}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &robotsRules{}
+	}
+	return parseRobots(io.LimitReader(resp.Body, 512*1024), r.userAgent)
+}
+
+// parseRobots extracts the rules for userAgent, falling back to the "*" group.
+// A group applies if its User-agent's product token is userAgent's, ignoring
+// case and version: "MyBot/2.0" and "mybot" both match "MyBot/1.0 (+url)".
+func parseRobots(body io.Reader, userAgent string) *robotsRules {
+	token := productToken(userAgent)
+
+	var specific, wildcard *robotsRules
+	var current []*robotsRules
+	var sitemaps []string
+	inAgents := false
+
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i != -1 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			// Consecutive User-agent lines share one group
+			if !inAgents {
+				current = nil
+			}
+			inAgents = true
+			agent := productToken(value)
+			switch {
+			case agent == "*":
+				if wildcard == nil {
+					wildcard = &robotsRules{}
+				}
+				current = append(current, wildcard)
+			case agent != "" && agent == token:
+				if specific == nil {
+					specific = &robotsRules{}
+				}
+				current = append(current, specific)
+			}
+		case "allow", "disallow", "crawl-delay":
+			inAgents = false
+			for _, g := range current {
+				switch key {
+				case "allow":
+					if value != "" {
+						g.Allow = append(g.Allow, value)
+					}
+				case "disallow":
+					if value != "" {
+						g.Disallow = append(g.Disallow, value)
+					}
+				case "crawl-delay":
+					if secs, err := strconv.ParseFloat(value, 64); err == nil && secs > 0 {
+						g.CrawlDelay = time.Duration(secs * float64(time.Second))
+					}
+				}
+			}
+		case "sitemap":
+			// Sitemap lines stand outside the groups, so they don't end one
+			if value != "" {
+				sitemaps = append(sitemaps, value)
+			}
+		default:
+			inAgents = false
+		}
+	}
+
+	rules := &robotsRules{}
+	if specific != nil {
+		rules = specific
+	} else if wildcard != nil {
+		rules = wildcard
+	}
+	rules.Sitemaps = sitemaps
+	return rules
+}
+
+// productToken is the lowercased name a User-Agent starts with, without its
+// version or comments.
+func productToken(userAgent string) string {
+	token := strings.ToLower(strings.TrimSpace(userAgent))
+	if i := strings.IndexAny(token, "/ "); i != -1 {
+		token = token[:i]
+	}
+	return token
+}
+
+// allows applies the longest-match rule: the most specific matching pattern
+// wins, and Allow beats Disallow on a tie.
+func (r *robotsRules) allows(path string) bool {
+	best, allowed := -1, true
+	for _, p := range r.Disallow {
+		if robotsMatch(p, path) && len(p) > best {
+			best, allowed = len(p), false
+		}
+	}
+	for _, p := range r.Allow {
+		if robotsMatch(p, path) && len(p) >= best {
+			best, allowed = len(p), true
+		}
+	}
+	return allowed
+}
+
+// robotsMatch supports the "*" wildcard and the "$" end anchor.
+func robotsMatch(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	rest := path[len(parts[0]):]
+	for i, part := range parts[1:] {
+		if anchored && i == len(parts)-2 {
+			return strings.HasSuffix(rest, part)
+		}
+		j := strings.Index(rest, part)
+		if j == -1 {
+			return false
+		}
+		rest = rest[j+len(part):]
+	}
+	return !anchored || rest == ""
+}
@@ -0,0 +1,90 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Sitemap lines apply to every agent wherever they appear, including inside
+// another agent's group, and don't end the group they interrupt.
+func TestParseRobotsSitemaps(t *testing.T) {
+	rules := parseRobots(strings.NewReader(`Sitemap: https://example.com/sitemap-pages.xml
+User-agent: *
+Sitemap: /sitemap-news.xml
+Disallow: /private
+
+User-agent: other-bot
+SITEMAP: https://cdn.example.com/sitemap-images.xml.gz # images
+Disallow: /
+sitemap:
+`), DefaultUserAgent)
+
+	want := []string{
+		"https://example.com/sitemap-pages.xml",
+		"/sitemap-news.xml",
+		"https://cdn.example.com/sitemap-images.xml.gz",
+	}
+	if !reflect.DeepEqual(rules.Sitemaps, want) {
+		t.Errorf("Sitemaps = %q, want %q", rules.Sitemaps, want)
+	}
+	if !reflect.DeepEqual(rules.Disallow, []string{"/private"}) {
+		t.Errorf("Disallow = %q, want [/private]", rules.Disallow)
+	}
+}
+
+// A group applies only if its User-agent names our product token, whatever
+// the case or version; anything else falls back to the "*" group.
+func TestParseRobotsUserAgent(t *testing.T) {
+	const robots = `User-agent: *
+Disallow: /wildcard
+
+User-agent: %s
+Disallow: /specific
+`
+	tests := []struct {
+		agent string
+		want  string
+	}{
+		{"go-microservices-web-scraper", "/specific"},
+		{"GO-Microservices-Web-Scraper", "/specific"},
+		{"go-microservices-web-scraper/2.0", "/specific"},
+		{"", "/wildcard"},
+		{"go", "/wildcard"},
+		{"scraper", "/wildcard"},
+		{"go-microservices-web-scraper-beta", "/wildcard"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.agent, func(t *testing.T) {
+			rules := parseRobots(strings.NewReader(strings.Replace(robots, "%s", tt.agent, 1)), DefaultUserAgent)
+			if !reflect.DeepEqual(rules.Disallow, []string{tt.want}) {
+				t.Errorf("Disallow = %q, want [%s]", rules.Disallow, tt.want)
+			}
+		})
+	}
+}
+
+// A robots.txt that never answers is given up on after the fetch timeout,
+// allowing everything.
+func TestRobotsFetchTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	robots := NewRobotsCache(nil, server.Client(), DefaultUserAgent, 100*time.Millisecond)
+	start := time.Now()
+	if allowed, _ := robots.Allowed(context.Background(), server.URL+"/a"); !allowed {
+		t.Error("Allowed = false without a robots.txt")
+	}
+	if waited := time.Since(start); waited > 2*time.Second {
+		t.Errorf("robots.txt fetch gave up after %v, want about 100ms", waited)
+	}
+}
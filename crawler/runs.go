@@ -0,0 +1,121 @@
+package crawler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// runsKey is the Redis hash of run records, keyed by run ID. It is shared by
+// every job and isn't deleted by Reset, so it keeps the crawl history.
+const runsKey = "runs"
+
+// Run is the record of one Start of a job, kept in the runs hash for
+// auditing. It is written when the crawl starts, with Outcome "running", and
+// rewritten with the final counts when Start returns; a run still "running"
+// long after it began was killed before it could finish. The counts cover the
+// whole job, as in the --stats-out file.
+type Run struct {
+	ID    string `json:"id"`
+	JobID string `json:"job_id"`
+	// Host is the machine the run's process ran on
+	Host       string   `json:"host"`
+	Seeds      []string `json:"seeds"`
+	ConfigHash string   `json:"config_hash"`
+	WorkerOnly bool     `json:"worker_only,omitempty"`
+	Daemon     bool     `json:"daemon,omitempty"`
+	DryRun     bool     `json:"dry_run,omitempty"`
+	// Outcome is "running", "completed", "timed_out" or "interrupted"
+	Outcome         string    `json:"outcome"`
+	StartedAt       time.Time `json:"started_at"`
+	FinishedAt      time.Time `json:"finished_at,omitempty"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	UniquePages     int64     `json:"unique_pages"`
+	PagesFetched    int64     `json:"pages_fetched"`
+	Errors          int64     `json:"errors"`
+}
+
+// newRun starts the record of a run beginning at started, with an ID sorting
+// by start time.
+func (c *Crawler) newRun(started time.Time) Run {
+	host, _ := os.Hostname()
+	return Run{
+		ID:         started.UTC().Format("20060102T150405Z") + "-" + randomHex(3),
+		JobID:      c.jobID,
+		Host:       host,
+		Seeds:      c.seeds,
+		ConfigHash: c.configHash,
+		WorkerOnly: c.workerOnly,
+		Daemon:     c.daemon,
+		DryRun:     c.dryRun,
+		Outcome:    "running",
+		StartedAt:  started.UTC(),
+	}
+}
+
+// finish fills in run's outcome and counts from the crawl's stats.
+func (run *Run) finish(stats crawlStats) {
+	run.Outcome = stats.Outcome
+	run.FinishedAt = stats.FinishedAt
+	run.DurationSeconds = stats.DurationSeconds
+	run.UniquePages = stats.UniquePages
+	run.PagesFetched = stats.PagesFetched
+	run.Errors = stats.Errors
+}
+
+// recordRun writes run to the runs hash.
+func (r *RedisClient) recordRun(ctx context.Context, run Run) error {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	return r.client.HSet(ctx, runsKey, run.ID, data).Err()
+}
+
+// ListRuns connects to the Redis server cfg describes and returns every
+// recorded run, of every job, oldest first.
+func ListRuns(ctx context.Context, cfg Config) ([]Run, error) {
+	opts, err := cfg.redisOptions()
+	if err != nil {
+		return nil, err
+	}
+	redisClient, err := NewRedisClient(cfg.RedisMode, opts, cfg.JobID, cfg.RedisConnectTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer redisClient.CloseConnection()
+
+	records, err := redisClient.client.HGetAll(ctx, runsKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	runs := make([]Run, 0, len(records))
+	for id, data := range records {
+		var run Run
+		if err := json.Unmarshal([]byte(data), &run); err != nil {
+			return nil, fmt.Errorf("unmarshaling run %s: %w", id, err)
+		}
+		runs = append(runs, run)
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].ID < runs[j].ID })
+	return runs, nil
+}
+
+// hash identifies the settings a crawl ran with, so runs of a job can be
+// told apart when its flags changed. Credentials and the values that can't be
+// serialized are left out.
+func (cfg Config) hash() string {
+	cfg.RedisPassword, cfg.RedisURL, cfg.LoginForm, cfg.PostBody = "", "", nil, ""
+	cfg.Queue, cfg.Visited, cfg.Storage, cfg.CookieJar = nil, nil, nil, nil
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
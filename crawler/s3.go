@@ -0,0 +1,205 @@
+package crawler
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// s3Timeout bounds each object upload.
+const s3Timeout = 30 * time.Second
+
+// S3Store saves fetched page bodies to an S3 bucket as
+// <prefix><sha256(url)>.html. It signs requests itself with AWS Signature
+// Version 4, taking credentials from the standard AWS environment variables.
+type S3Store struct {
+	client *http.Client
+	bucket string
+	prefix string
+	region string
+	// endpoint is set for S3-compatible stores, which are addressed path-style
+	endpoint *url.URL
+
+	accessKey    string
+	secretKey    string
+	sessionToken string
+}
+
+// NewS3Store reads AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and the optional
+// AWS_SESSION_TOKEN for credentials, and AWS_REGION or AWS_DEFAULT_REGION for
+// the bucket's region (us-east-1 if neither is set). AWS_ENDPOINT_URL_S3 or
+// AWS_ENDPOINT_URL points it at an S3-compatible store such as MinIO instead.
+func NewS3Store(bucket, prefix string) (*S3Store, error) {
+	s := &S3Store{
+		client: &http.Client{Timeout: s3Timeout},
+		bucket: bucket,
+		prefix: prefix,
+		region: firstEnv("AWS_REGION", "AWS_DEFAULT_REGION"),
+
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if s.accessKey == "" || s.secretKey == "" {
+		return nil, errors.New("S3 storage needs AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	if s.region == "" {
+		s.region = "us-east-1"
+	}
+	if endpoint := firstEnv("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"); endpoint != "" {
+		u, err := url.Parse(endpoint)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid S3 endpoint %q", endpoint)
+		}
+		s.endpoint = u
+	}
+	return s, nil
+}
+
+// Put uploads data as <prefix><key>.html.
+func (s *S3Store) Put(key string, data []byte) error {
+	req, err := http.NewRequest(http.MethodPut, s.objectURL(s.prefix+key+".html"), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/html")
+	s.sign(req, data, time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("S3 PUT %s: %s: %s", key, resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// Close is a no-op; uploads finish before Put returns.
+func (s *S3Store) Close() error {
+	return nil
+}
+
+// objectURL addresses key virtual-hosted style on AWS, or path-style on a
+// custom endpoint.
+func (s *S3Store) objectURL(key string) string {
+	path := "/" + s3Escape(key)
+	if s.endpoint == nil {
+		return fmt.Sprintf("https://%s.s3.%s.amazonaws.com%s", s.bucket, s.region, path)
+	}
+	return fmt.Sprintf("%s://%s%s/%s%s", s.endpoint.Scheme, s.endpoint.Host, strings.TrimSuffix(s.endpoint.Path, "/"), s3Escape(s.bucket), path)
+}
+
+// sign adds the Signature Version 4 Authorization header to req, whose body
+// is payload. Every header already set on req is signed.
+func (s *S3Store) sign(req *http.Request, payload []byte, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	payloadHash := sha256Hex(payload)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.sessionToken)
+	}
+
+	canonical, signedHeaders := canonicalRequest(req, payloadHash)
+	signature := s.signature(amzDate, s.stringToSign(amzDate, canonical))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", s.accessKey, s.scope(amzDate), signedHeaders, signature))
+}
+
+// canonicalRequest is req in Signature Version 4's canonical form, with the
+// names of the headers it signs.
+func canonicalRequest(req *http.Request, payloadHash string) (canonical, signedHeaders string) {
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders = strings.Join(names, ";")
+
+	canonical = strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	return canonical, signedHeaders
+}
+
+// scope is the credential scope of a request signed at amzDate.
+func (s *S3Store) scope(amzDate string) string {
+	return amzDate[:8] + "/" + s.region + "/s3/aws4_request"
+}
+
+// stringToSign is what a request signed at amzDate signs.
+func (s *S3Store) stringToSign(amzDate, canonical string) string {
+	return strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, s.scope(amzDate), sha256Hex([]byte(canonical))}, "\n")
+}
+
+// signature signs stringToSign with a key derived from the secret key for
+// amzDate's day.
+func (s *S3Store) signature(amzDate, stringToSign string) string {
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), amzDate[:8])
+	for _, part := range []string{s.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// s3Escape percent-encodes an object key the way Signature Version 4 expects:
+// everything but unreserved characters and the "/" separators.
+func s3Escape(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// firstEnv returns the first of the named environment variables that is set.
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
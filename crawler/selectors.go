@@ -0,0 +1,55 @@
+package crawler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+)
+
+// extractor pulls one named field out of a page with a CSS selector.
+type extractor struct {
+	name     string
+	selector cascadia.Sel
+}
+
+// compileExtractors compiles Config.Extract, sorted by field name, failing on
+// the first invalid selector.
+func compileExtractors(fields map[string]string) ([]extractor, error) {
+	var extractors []extractor
+	for name, selector := range fields {
+		sel, err := cascadia.Parse(selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --extract selector %q for %s: %w", selector, name, err)
+		}
+		extractors = append(extractors, extractor{name: name, selector: sel})
+	}
+	sort.Slice(extractors, func(i, j int) bool { return extractors[i].name < extractors[j].name })
+	return extractors, nil
+}
+
+// extractFields runs the extractors over the parsed document. A field's value
+// is the text of every element its selector matches, in document order, with
+// whitespace collapsed and one element per line. Fields that match nothing,
+// or only empty elements, are left out; nil is returned if none matched.
+func extractFields(doc *html.Node, extractors []extractor) map[string]string {
+	var fields map[string]string
+	for _, e := range extractors {
+		var texts []string
+		for _, n := range cascadia.QueryAll(doc, e.selector) {
+			if text := strings.Join(strings.Fields(textContent(n)), " "); text != "" {
+				texts = append(texts, text)
+			}
+		}
+		if len(texts) == 0 {
+			continue
+		}
+		if fields == nil {
+			fields = make(map[string]string, len(extractors))
+		}
+		fields[e.name] = strings.Join(texts, "\n")
+	}
+	return fields
+}
@@ -0,0 +1,136 @@
+package crawler
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// maxSitemaps bounds how many sitemap files a single sitemap index may expand to.
+const maxSitemaps = 1000
+
+// sitemapDoc decodes both <urlset> and <sitemapindex> documents; only one of
+// the two slices is populated for any given file.
+type sitemapDoc struct {
+	URLs     []sitemapLoc `xml:"url"`
+	Sitemaps []sitemapLoc `xml:"sitemap"`
+}
+
+type sitemapLoc struct {
+	Loc string `xml:"loc"`
+}
+
+// seedFromSitemap fetches the sitemaps the seed host's robots.txt lists, or
+// <scheme>://<host>/sitemap.xml if it lists none, and enqueues every <loc>
+// they contain at depth 0, following sitemap index files. It returns how many
+// URLs were enqueued, and the first error fetching one of those root sitemaps.
+func (c *Crawler) seedFromSitemap(ctx context.Context, seedURL string) (int, error) {
+	seed, err := url.Parse(seedURL)
+	if err != nil {
+		return 0, err
+	}
+	roots := c.robots.Sitemaps(ctx, seedURL)
+	if len(roots) == 0 {
+		roots = []string{seed.Scheme + "://" + seed.Host + "/sitemap.xml"}
+	}
+
+	var pending []string
+	seen := make(map[string]bool)
+	isRoot := make(map[string]bool)
+	for _, root := range roots {
+		if !seen[root] {
+			seen[root] = true
+			isRoot[root] = true
+			pending = append(pending, root)
+		}
+	}
+	count := 0
+	var rootErr error
+
+	for len(pending) > 0 && len(seen) <= maxSitemaps {
+		sitemapURL := pending[0]
+		pending = pending[1:]
+
+		if allowed, _ := c.robots.Allowed(ctx, sitemapURL); !allowed {
+			continue
+		}
+
+		doc, err := c.fetchSitemap(ctx, sitemapURL)
+		if err != nil {
+			// A missing root sitemap is worth reporting; broken children are not fatal
+			if isRoot[sitemapURL] && rootErr == nil {
+				rootErr = err
+			}
+			continue
+		}
+
+		for _, child := range doc.Sitemaps {
+			loc := strings.TrimSpace(child.Loc)
+			if loc != "" && !seen[loc] {
+				seen[loc] = true
+				pending = append(pending, loc)
+			}
+		}
+		for _, entry := range doc.URLs {
+			loc := strings.TrimSpace(entry.Loc)
+			if loc == "" || c.outOfScope(loc) != "" {
+				continue
+			}
+			c.enqueue(ctx, WorkItem{URL: loc, TraceID: newTraceID()})
+			count++
+		}
+	}
+	return count, rootErr
+}
+
+// fetchSitemap downloads and decodes one sitemap, transparently handling
+// gzip-compressed (.xml.gz) files.
+func (c *Crawler) fetchSitemap(ctx context.Context, sitemapURL string) (*sitemapDoc, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.httpTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", sitemapURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range c.fetchOpts.headers {
+		for _, v := range values {
+			req.Header.Add(key, v)
+		}
+	}
+
+	resp, err := c.fetchOpts.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("sitemap %s: status error: %d", sitemapURL, resp.StatusCode)
+	}
+
+	// Sniff the gzip magic bytes rather than trusting the extension or headers,
+	// since servers often mislabel compressed sitemaps
+	body := bufio.NewReader(resp.Body)
+	var r io.Reader = body
+	if magic, err := body.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	var doc sitemapDoc
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("sitemap %s: %w", sitemapURL, err)
+	}
+	return &doc, nil
+}
@@ -0,0 +1,54 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// urlset is a sitemap listing paths on base.
+func urlset(base string, paths ...string) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?><urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`)
+	for _, path := range paths {
+		fmt.Fprintf(&b, "<url><loc>%s%s</loc></url>", base, path)
+	}
+	return b.String() + "</urlset>"
+}
+
+// Every sitemap a robots.txt lists seeds the crawl, while its rules still
+// keep disallowed sitemap entries out.
+func TestSitemapsFromRobots(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprintf(w, "User-agent: *\nDisallow: /private\nSitemap: %s/sitemap-a.xml\nSitemap: /sitemap-b.xml\n", server.URL)
+		case "/sitemap-a.xml":
+			fmt.Fprint(w, urlset(server.URL, "/a1", "/a2"))
+		case "/sitemap-b.xml":
+			fmt.Fprint(w, urlset(server.URL, "/b1", "/private/b2"))
+		case "/sitemap.xml":
+			fmt.Fprint(w, urlset(server.URL, "/default"))
+		case "/", "/a1", "/a2", "/b1", "/private/b2", "/default":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, links())
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	cfg := memoryConfig(server.URL + "/")
+	cfg.IgnoreRobots = false
+	cfg.UseSitemap = true
+	cfg.MaxDepth = 0
+	got := sortedKeys(depthsByURL(crawl(t, cfg)))
+	want := []string{server.URL + "/", server.URL + "/a1", server.URL + "/a2", server.URL + "/b1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("crawled %q, want %q", got, want)
+	}
+}
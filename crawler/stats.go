@@ -0,0 +1,74 @@
+package crawler
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// crawlStats is the machine-readable summary written to StatsOut.
+type crawlStats struct {
+	JobID string `json:"job_id"`
+	// Outcome is "completed", "timed_out" or "interrupted"
+	Outcome         string           `json:"outcome"`
+	DryRun          bool             `json:"dry_run"`
+	StartedAt       time.Time        `json:"started_at"`
+	FinishedAt      time.Time        `json:"finished_at"`
+	DurationSeconds float64          `json:"duration_seconds"`
+	UniquePages     int64            `json:"unique_pages"`
+	PagesFetched    int64            `json:"pages_fetched"`
+	PagesPerSecond  float64          `json:"pages_per_second"`
+	Errors          int64            `json:"errors"`
+	StatusCodes     map[string]int64 `json:"status_codes"`
+	PagesByHost     map[string]int64 `json:"pages_by_host"`
+	NotModified     int64            `json:"not_modified"`
+	Soft404s        int              `json:"soft_404s"`
+	TLSErrors       int              `json:"tls_errors"`
+	QueueOverflow   int64            `json:"queue_overflow"`
+}
+
+// newCrawlStats builds the summary of a crawl that began at started from its
+// Result and the job's per-host page counts.
+func newCrawlStats(jobID string, started time.Time, result *Result, byHost map[string]int64, interrupted bool) crawlStats {
+	stats := crawlStats{
+		JobID:           jobID,
+		Outcome:         "completed",
+		DryRun:          result.DryRun,
+		StartedAt:       started.UTC(),
+		FinishedAt:      started.Add(result.Duration).UTC(),
+		DurationSeconds: result.Duration.Seconds(),
+		UniquePages:     result.UniquePages,
+		StatusCodes:     result.StatusCounts,
+		PagesByHost:     byHost,
+		NotModified:     result.NotModified,
+		Soft404s:        len(result.Soft404s),
+		TLSErrors:       len(result.TLSErrors),
+		QueueOverflow:   result.QueueOverflow,
+	}
+	switch {
+	case interrupted:
+		stats.Outcome = "interrupted"
+	case result.TimedOut:
+		stats.Outcome = "timed_out"
+	}
+	stats.PagesFetched, stats.Errors = countFetches(result.StatusCounts)
+	if secs := result.Duration.Seconds(); secs > 0 {
+		stats.PagesPerSecond = float64(stats.PagesFetched) / secs
+	}
+	if stats.StatusCodes == nil {
+		stats.StatusCodes = map[string]int64{}
+	}
+	if stats.PagesByHost == nil {
+		stats.PagesByHost = map[string]int64{}
+	}
+	return stats
+}
+
+// writeStats writes stats to path as indented JSON.
+func writeStats(path string, stats crawlStats) error {
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
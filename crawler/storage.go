@@ -0,0 +1,89 @@
+package crawler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// manifestName is the file inside the output directory that maps page
+// filenames back to the URLs they were fetched from.
+const manifestName = "manifest.tsv"
+
+// Storage saves fetched page bodies. Keys are the sha256 of the page's URL,
+// so recrawling a URL overwrites its earlier body.
+type Storage interface {
+	Put(key string, data []byte) error
+	Close() error
+}
+
+// urlIndexer is implemented by stores that keep their own key -> URL index.
+type urlIndexer interface {
+	index(key, u string) error
+}
+
+// urlKeyer is implemented by stores that key pages by something other than
+// the URL hash, such as MirrorStore's site paths.
+type urlKeyer interface {
+	keyFor(u string) string
+}
+
+// PageStore saves fetched page bodies to disk as <sha256(url)>.html.
+type PageStore struct {
+	dir string
+
+	mu       sync.Mutex
+	manifest *os.File
+}
+
+func NewPageStore(dir string) (*PageStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating output dir: %w", err)
+	}
+	manifest, err := os.OpenFile(filepath.Join(dir, manifestName), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("opening manifest: %w", err)
+	}
+	return &PageStore{dir: dir, manifest: manifest}, nil
+}
+
+// Put writes data to <key>.html in the output directory.
+func (s *PageStore) Put(key string, data []byte) error {
+	return os.WriteFile(filepath.Join(s.dir, key+".html"), data, 0o644)
+}
+
+// index appends a "<hash>\t<url>" manifest line.
+func (s *PageStore) index(key, u string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := fmt.Fprintf(s.manifest, "%s\t%s\n", key, u)
+	return err
+}
+
+func (s *PageStore) Close() error {
+	return s.manifest.Close()
+}
+
+// storePage saves u's body under its URL hash, or the store's own key for u,
+// indexing it if the store keeps an index.
+func storePage(s Storage, u string, body []byte) error {
+	key := urlHash(u)
+	if k, ok := s.(urlKeyer); ok {
+		key = k.keyFor(u)
+	}
+	if err := s.Put(key, body); err != nil {
+		return err
+	}
+	if idx, ok := s.(urlIndexer); ok {
+		return idx.index(key, u)
+	}
+	return nil
+}
+
+func urlHash(u string) string {
+	sum := sha256.Sum256([]byte(u))
+	return hex.EncodeToString(sum[:])
+}
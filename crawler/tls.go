@@ -0,0 +1,38 @@
+package crawler
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+)
+
+// tlsFailure returns a short description of why a fetch failed on the
+// server's certificate or the TLS handshake, e.g. "expired certificate", or
+// "" if err isn't a TLS error. These fail on every retry, so the crawler logs
+// them as warnings and records them in tls_errors:<id> for reporting.
+func tlsFailure(err error) string {
+	var invalid x509.CertificateInvalidError
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var verification *tls.CertificateVerificationError
+	var alert tls.AlertError
+	var record tls.RecordHeaderError
+	switch {
+	case errors.As(err, &invalid):
+		if invalid.Reason == x509.Expired {
+			return "expired or not yet valid certificate"
+		}
+		return "invalid certificate"
+	case errors.As(err, &unknownAuthority):
+		return "certificate signed by unknown authority (self-signed?)"
+	case errors.As(err, &hostname):
+		return "certificate does not match host name"
+	case errors.As(err, &verification):
+		return "certificate verification failed"
+	case errors.As(err, &alert):
+		return "handshake rejected by server"
+	case errors.As(err, &record):
+		return "server did not answer with TLS"
+	}
+	return ""
+}
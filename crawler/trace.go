@@ -0,0 +1,36 @@
+package crawler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// Every job carries the trace ID of the seed it was discovered from, so one
+// crawl branch can be followed through the logs and results. Each time a job
+// is processed it gets a fresh span ID, which the jobs queued from its links
+// record as their parent span. The IDs have the sizes of W3C Trace Context
+// trace and span IDs.
+
+// newTraceID returns a random 32-character hex trace ID for a seed.
+func newTraceID() string {
+	return randomHex(16)
+}
+
+// newSpanID returns a random 16-character hex span ID for one processing of
+// a job.
+func newSpanID() string {
+	return randomHex(8)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	// crypto/rand.Read doesn't fail on supported platforms
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestID is the value of the request ID header sent with item's fetch:
+// its trace and span IDs, joined by a dash.
+func (item WorkItem) requestID() string {
+	return item.TraceID + "-" + item.SpanID
+}
@@ -0,0 +1,190 @@
+package crawler
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// The crawl is done once the job's queue is empty and no worker in any
+// process is holding a job, on doneStableChecks checks in a row taken
+// doneCheckInterval apart. Requiring several checks covers the moment between
+// a worker popping a job and counting it as in flight.
+const (
+	doneCheckInterval = 500 * time.Millisecond
+	doneStableChecks  = 3
+)
+
+// Jobs in flight are counted per process, in the process_inflight:<id> hash
+// keyed by process ID, and each process holds a lease in process_leases:<id>,
+// a sorted set scored by when the lease expires. A running process renews its
+// lease every processLeaseRenew. InFlight only counts the jobs of processes
+// with a live lease, so the jobs of one killed mid-page stop counting once its
+// lease lapses, without anyone clearing a count another process still needs.
+const (
+	processLeaseTTL   = 30 * time.Second
+	processLeaseRenew = 10 * time.Second
+)
+
+// StartJob counts a popped job as in flight for this process, so other
+// processes don't consider the crawl finished while it is being processed.
+func (r *RedisClient) StartJob(ctx context.Context) error {
+	return retry(ctx, "start_job", func() error {
+		return r.client.HIncrBy(ctx, r.key("process_inflight"), r.process, 1).Err()
+	})
+}
+
+// FinishJob marks a job started with StartJob as done.
+func (r *RedisClient) FinishJob(ctx context.Context) error {
+	return retry(ctx, "finish_job", func() error {
+		return r.client.HIncrBy(ctx, r.key("process_inflight"), r.process, -1).Err()
+	})
+}
+
+// InFlight returns how many jobs are being processed across all processes
+// holding a lease.
+func (r *RedisClient) InFlight(ctx context.Context) (int64, error) {
+	live, err := r.client.ZRangeByScore(ctx, r.key("process_leases"), &redis.ZRangeBy{
+		Min: strconv.FormatInt(time.Now().UnixMilli(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil || len(live) == 0 {
+		return 0, err
+	}
+	counts, err := r.client.HMGet(ctx, r.key("process_inflight"), live...).Result()
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, count := range counts {
+		if s, ok := count.(string); ok {
+			n, _ := strconv.ParseInt(s, 10, 64)
+			total += n
+		}
+	}
+	return total, nil
+}
+
+// renewLease extends this process's lease by processLeaseTTL, and forgets
+// the processes whose leases have lapsed along with their counts.
+func (r *RedisClient) renewLease(ctx context.Context) error {
+	now := time.Now()
+	expired, err := r.client.ZRangeByScore(ctx, r.key("process_leases"), &redis.ZRangeBy{
+		Min: "-inf",
+		Max: "(" + strconv.FormatInt(now.UnixMilli(), 10),
+	}).Result()
+	if err != nil {
+		return err
+	}
+	if len(expired) > 0 {
+		if err := r.client.HDel(ctx, r.key("process_inflight"), expired...).Err(); err != nil {
+			return err
+		}
+		members := make([]interface{}, len(expired))
+		for i, process := range expired {
+			members[i] = process
+		}
+		if err := r.client.ZRem(ctx, r.key("process_leases"), members...).Err(); err != nil {
+			return err
+		}
+	}
+	return r.client.ZAdd(ctx, r.key("process_leases"), &redis.Z{
+		Score:  float64(now.Add(processLeaseTTL).UnixMilli()),
+		Member: r.process,
+	}).Err()
+}
+
+// holdLease takes this process's lease and renews it until the returned
+// release is called, which gives it up along with the process's count.
+// Renewal carries on after ctx is cancelled, for as long as the workers
+// finish their pages.
+func (r *RedisClient) holdLease(ctx context.Context) (release func()) {
+	ctx = context.WithoutCancel(ctx)
+	if err := r.renewLease(ctx); err != nil {
+		slog.Warn("Redis error taking in-flight lease", "error", err)
+	}
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(processLeaseRenew)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := r.renewLease(ctx); err != nil {
+					slog.Warn("Redis error renewing in-flight lease", "error", err)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-stopped
+		if err := r.client.ZRem(ctx, r.key("process_leases"), r.process).Err(); err != nil {
+			slog.Warn("Redis error releasing in-flight lease", "error", err)
+		}
+		if err := r.client.HDel(ctx, r.key("process_inflight"), r.process).Err(); err != nil {
+			slog.Warn("Redis error releasing in-flight lease", "error", err)
+		}
+	}
+}
+
+// waitDone blocks until the shared queue is empty and nothing is in flight
+// for doneStableChecks checks in a row, or ctx is cancelled. A worker-only
+// process first waits for the seeder to mark a URL visited, so starting the
+// workers before the seeder doesn't end the crawl straight away. The memory
+// backend's own queue counts its pending jobs exactly instead.
+func (c *Crawler) waitDone(ctx context.Context) {
+	if memory, ok := c.queue.(*memoryBackend); ok {
+		memory.wait(ctx)
+		return
+	}
+
+	ticker := time.NewTicker(doneCheckInterval)
+	defer ticker.Stop()
+
+	started := !c.workerOnly
+	idle := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if !started {
+			visited, err := c.visited.VisitedCount(ctx)
+			if err != nil || visited == 0 {
+				continue
+			}
+			started = true
+		}
+
+		queued, err := c.queue.QueueLen(ctx)
+		if err != nil {
+			slog.Warn("Error checking queue length", "error", err)
+			idle = 0
+			continue
+		}
+		inflight, err := c.counters.InFlight(ctx)
+		if err != nil {
+			slog.Warn("Error checking in-flight jobs", "error", err)
+			idle = 0
+			continue
+		}
+
+		if queued > 0 || inflight > 0 {
+			idle = 0
+			continue
+		}
+		if idle++; idle >= doneStableChecks {
+			return
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// serveTree serves pages /p/0 to /p/n-1 as a binary tree: page i links to
+// its children 2i+1 and 2i+2 and back to the root, so workers keep finding
+// both new and already visited links while others drain the queue.
+func serveTree(t *testing.T, n int) string {
+	t.Helper()
+	pages := make(map[string]string, n)
+	for i := range n {
+		var hrefs []string
+		for _, child := range []int{2*i + 1, 2*i + 2} {
+			if child < n {
+				hrefs = append(hrefs, fmt.Sprintf("/p/%d", child))
+			}
+		}
+		pages[fmt.Sprintf("/p/%d", i)] = links(append(hrefs, "/p/0")...)
+	}
+	return serveSite(t, pages).URL + "/p/0"
+}
+
+// The crawl must end exactly when every page is done: not before, with
+// pages still being processed, and not hang once the queue has drained.
+func TestCrawlCompletesMemory(t *testing.T) {
+	const pages = 300
+	seed := serveTree(t, pages)
+	for run := range 5 {
+		cfg := memoryConfig(seed)
+		cfg.MaxDepth = 20
+		cfg.Workers = 32
+		if got := len(crawl(t, cfg)); got != pages {
+			t.Fatalf("run %d: crawled %d pages, want %d", run, got, pages)
+		}
+	}
+}
+
+func TestCrawlCompletesRedis(t *testing.T) {
+	const pages = 150
+	seed := serveTree(t, pages)
+	r, server := newTestRedis(t)
+
+	cfg := memoryConfig(seed)
+	cfg.Backend = "redis"
+	cfg.RedisAddr = server.Addr()
+	cfg.JobID = r.jobID
+	cfg.MaxDepth = 20
+	cfg.Workers = 16
+	if got := len(crawl(t, cfg)); got != pages {
+		t.Fatalf("crawled %d pages, want %d", got, pages)
+	}
+
+	ctx := context.Background()
+	if n, err := r.InFlight(ctx); err != nil || n != 0 {
+		t.Errorf("InFlight after the crawl = %d, %v; want 0, nil", n, err)
+	}
+	if n, err := r.QueueLen(ctx); err != nil || n != 0 {
+		t.Errorf("QueueLen after the crawl = %d, %v; want 0, nil", n, err)
+	}
+}
+
+// A seed without links is the whole crawl; the workers still polling an
+// empty queue mustn't keep it running.
+func TestCrawlCompletesSeedWithoutLinks(t *testing.T) {
+	site := serveSite(t, map[string]string{"/": links()})
+	cfg := memoryConfig(site.URL + "/")
+	cfg.Workers = 8
+	if got := len(crawl(t, cfg)); got != 1 {
+		t.Fatalf("crawled %d pages, want 1", got)
+	}
+}
+
+// A process killed mid-page leaves its jobs counted until its lease lapses;
+// after that they stop counting without touching other processes' counts.
+func TestInFlightIgnoresLapsedLeases(t *testing.T) {
+	live, server := newTestRedis(t)
+	ctx := context.Background()
+	release := live.holdLease(ctx)
+	defer release()
+	if err := live.StartJob(ctx); err != nil {
+		t.Fatalf("StartJob: %v", err)
+	}
+
+	dead := *live
+	dead.process = "dead"
+	if err := dead.renewLease(ctx); err != nil {
+		t.Fatalf("renewLease: %v", err)
+	}
+	for range 2 {
+		if err := dead.StartJob(ctx); err != nil {
+			t.Fatalf("StartJob: %v", err)
+		}
+	}
+	if n, err := live.InFlight(ctx); err != nil || n != 3 {
+		t.Fatalf("InFlight with both leases live = %d, %v; want 3, nil", n, err)
+	}
+
+	// Lapse the dead process's lease
+	server.ZAdd("process_leases:test", float64(time.Now().Add(-time.Second).UnixMilli()), "dead")
+	if n, err := live.InFlight(ctx); err != nil || n != 1 {
+		t.Errorf("InFlight after the lease lapsed = %d, %v; want 1, nil", n, err)
+	}
+	if err := live.renewLease(ctx); err != nil {
+		t.Fatalf("renewLease: %v", err)
+	}
+	if server.Exists("process_inflight:test") && server.HGet("process_inflight:test", "dead") != "" {
+		t.Errorf("lapsed process's count not forgotten on renewal")
+	}
+
+	if err := live.FinishJob(ctx); err != nil {
+		t.Fatalf("FinishJob: %v", err)
+	}
+	if n, err := live.InFlight(ctx); err != nil || n != 0 {
+		t.Errorf("InFlight after FinishJob = %d, %v; want 0, nil", n, err)
+	}
+}
@@ -0,0 +1,143 @@
+package crawler
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	// dateSegment matches path segments such as 2024-05, 2024-05-17 or
+	// 20240517, whichever separator a calendar uses
+	dateSegment = regexp.MustCompile(`^\d{4}[-_.]?\d{2}([-_.]?\d{2})?$`)
+	digitRun    = regexp.MustCompile(`\d+`)
+)
+
+// urlTemplate reduces rawURL to the shape its crawler trap would share:
+// host, path with dates and numbers replaced by {date} and {n}, and the
+// sorted names of its query parameters without their values. Calendar pages
+// like /events/2024/05 and /events/2031/11, and faceted searches differing
+// only in their filter values, get the same template. It returns "" if
+// rawURL can't be parsed.
+func urlTemplate(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	segments := strings.Split(u.EscapedPath(), "/")
+	for i, segment := range segments {
+		if dateSegment.MatchString(segment) {
+			segments[i] = "{date}"
+		} else {
+			segments[i] = digitRun.ReplaceAllString(segment, "{n}")
+		}
+	}
+	template := strings.ToLower(u.Host) + strings.Join(segments, "/")
+	if query := u.Query(); len(query) > 0 {
+		names := make([]string, 0, len(query))
+		for name := range query {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		template += "?" + strings.Join(names, "&")
+	}
+	return template
+}
+
+// trapDetector caps how many distinct URLs sharing a urlTemplate are
+// crawled, to keep calendars and combinatorial query parameters from
+// swallowing the crawl. Counts are kept in the templates:<id> Redis hash so
+// the cap holds across processes; with a nil redisClient (the memory
+// backend) they are only kept in process. A nil trapDetector
+// (MaxPerTemplate 0) lets every URL through.
+type trapDetector struct {
+	redisClient *RedisClient
+	max         int
+
+	mu    sync.Mutex
+	local map[string]int
+	// full holds the templates that used their budget, so their links are
+	// dropped before being queued and each is only logged once
+	full map[string]bool
+}
+
+func newTrapDetector(redisClient *RedisClient, max int) *trapDetector {
+	return &trapDetector{
+		redisClient: redisClient,
+		max:         max,
+		local:       make(map[string]int),
+		full:        make(map[string]bool),
+	}
+}
+
+// claim takes one of the crawls allowed for rawURL's template. It returns
+// false once the template has used them all, logging the template the first
+// time. On a Redis error the URL is let through.
+func (t *trapDetector) claim(ctx context.Context, logger *slog.Logger, rawURL string) bool {
+	if t == nil {
+		return true
+	}
+	template := urlTemplate(rawURL)
+	if template == "" {
+		return true
+	}
+	t.mu.Lock()
+	full := t.full[template]
+	t.mu.Unlock()
+	if full {
+		return false
+	}
+
+	ok := true
+	if t.redisClient != nil {
+		var err error
+		if ok, err = t.claimRedis(ctx, template); err != nil {
+			logger.Warn("Redis error claiming URL template budget", "template", template, "error", err)
+			return true
+		}
+	} else {
+		t.mu.Lock()
+		if ok = t.local[template] < t.max; ok {
+			t.local[template]++
+		}
+		t.mu.Unlock()
+	}
+	if ok {
+		return true
+	}
+
+	t.mu.Lock()
+	first := !t.full[template]
+	t.full[template] = true
+	t.mu.Unlock()
+	if first {
+		logger.Info("Crawler trap suspected, skipping further URLs matching template", "template", template, "max_per_template", t.max)
+	}
+	return false
+}
+
+// claimRedis is claimHostPage on the templates:<id> hash.
+func (t *trapDetector) claimRedis(ctx context.Context, template string) (bool, error) {
+	var ok int
+	err := retry(ctx, "claim_template", func() (err error) {
+		ok, err = claimHostPage.Run(ctx, t.redisClient.client, []string{t.redisClient.key("templates")}, template, t.max).Int()
+		return err
+	})
+	return ok == 1, err
+}
+
+// trapped reports whether link's template is already known to have used its
+// budget in this process, so the link needn't be queued.
+func (t *trapDetector) trapped(link string) bool {
+	if t == nil {
+		return false
+	}
+	template := urlTemplate(link)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.full[template]
+}
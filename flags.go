@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// stringList collects the values of a repeatable flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// parseHeaders turns repeated --header "Key: Value" flags into an http.Header.
+func parseHeaders(raw []string) (http.Header, error) {
+	headers := make(http.Header)
+	for _, h := range raw {
+		key, value, ok := strings.Cut(h, ":")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid --header %q, expected \"Key: Value\"", h)
+		}
+		headers.Add(key, strings.TrimSpace(value))
+	}
+	return headers, nil
+}
+
+// parseDepthOverrides parses --depth-override "example.com=5,*.external.com=1"
+// into a map from host pattern to depth, returning nil when the flag is unset.
+func parseDepthOverrides(raw string) (map[string]int, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	overrides := make(map[string]int)
+	for _, entry := range splitList(raw) {
+		host, value, ok := strings.Cut(entry, "=")
+		host = strings.TrimSpace(host)
+		depth, err := strconv.Atoi(strings.TrimSpace(value))
+		if !ok || host == "" || err != nil {
+			return nil, fmt.Errorf("invalid --depth-override entry %q, expected \"host=depth\"", entry)
+		}
+		overrides[host] = depth
+	}
+	return overrides, nil
+}
+
+// parseResolve parses repeated --resolve "host:port:addr" flags, like curl's,
+// into a map from "host:port" to the IP address to connect to. IPv6
+// addresses may be given in brackets.
+func parseResolve(raw []string) (map[string]string, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	resolve := make(map[string]string, len(raw))
+	for _, entry := range raw {
+		host, rest, ok := strings.Cut(entry, ":")
+		port, addr, ok2 := strings.Cut(rest, ":")
+		addr = strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+		_, err := strconv.ParseUint(port, 10, 16)
+		if !ok || !ok2 || host == "" || err != nil || net.ParseIP(addr) == nil {
+			return nil, fmt.Errorf("invalid --resolve %q, expected \"host:port:addr\" with an IP address", entry)
+		}
+		resolve[net.JoinHostPort(strings.ToLower(host), port)] = addr
+	}
+	return resolve, nil
+}
+
+// parseExtract parses --extract "title=h1; price=.product-price" into a map
+// from field name to CSS selector, returning nil when the flag is unset.
+// Entries are split on ";" since selectors may contain commas.
+func parseExtract(raw string) (map[string]string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	fields := make(map[string]string)
+	for _, entry := range strings.Split(raw, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		name, selector, ok := strings.Cut(entry, "=")
+		name, selector = strings.TrimSpace(name), strings.TrimSpace(selector)
+		if !ok || name == "" || selector == "" {
+			return nil, fmt.Errorf("invalid --extract entry %q, expected \"name=selector\"", strings.TrimSpace(entry))
+		}
+		fields[name] = selector
+	}
+	return fields, nil
+}
+
+// parseLoginForm parses --login-form "user=alice&password=secret" into form
+// values, returning nil when the flag is unset.
+func parseLoginForm(raw string) (url.Values, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	form, err := url.ParseQuery(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --login-form %q: %w", raw, err)
+	}
+	return form, nil
+}
+
+// loadSeeds reads --seeds-file: one start URL per line, skipping blank lines
+// and lines starting with #. Every URL must be absolute http or https.
+func loadSeeds(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading --seeds-file: %w", err)
+	}
+	var seeds []string
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		u, err := url.Parse(line)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("%s:%d: invalid seed URL %q", path, i+1, line)
+		}
+		seeds = append(seeds, line)
+	}
+	return seeds, nil
+}
+
+// splitList parses a comma-separated flag value, dropping empty entries.
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// loadProxies parses --proxy and the lines of --proxy-file into proxy URLs.
+// Blank lines and lines starting with # are ignored.
+func loadProxies(proxy, proxyFile string) ([]*url.URL, error) {
+	var raw []string
+	if proxy != "" {
+		raw = append(raw, proxy)
+	}
+	if proxyFile != "" {
+		data, err := os.ReadFile(proxyFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading --proxy-file: %w", err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "#") {
+				raw = append(raw, line)
+			}
+		}
+	}
+
+	proxies := make([]*url.URL, 0, len(raw))
+	for _, r := range raw {
+		u, err := url.Parse(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy %q: %w", r, err)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, fmt.Errorf("invalid proxy %q: scheme must be http, https, or socks5", r)
+		}
+		if u.Host == "" {
+			return nil, fmt.Errorf("invalid proxy %q: missing host", r)
+		}
+		proxies = append(proxies, u)
+	}
+	return proxies, nil
+}